@@ -0,0 +1,213 @@
+package route
+
+import (
+	"fmt"
+	"sort"
+)
+
+// group is a run of the routes compiled into a single matcher, the routes are the alternatives
+// of the route expressions, see match.less for the order. The tries of the same priority with
+// equivalent mappers are merged into one trie, other matchers make the groups of a single route.
+// Groups are never modified once compiled, so the published snapshots can share them.
+//
+// The tries are ordered by the amount of conditions, which is the length of their mapper,
+// so the first route of the trie group has the longest mapper, the one the merged trie uses.
+type group struct {
+	// first and last are the first and the last routes of the group
+	first, last *match
+	matcher     matcher
+}
+
+func newGroup(m *match) *group {
+	return &group{first: m, last: m, matcher: m.matcher}
+}
+
+// routes returns the routes of the group in the match order,
+// it walks the whole merged trie, so it's used for the rare updates only
+func (g *group) routes() []*match {
+	t, ok := g.matcher.(*trie)
+	if !ok {
+		return []*match{g.first}
+	}
+	out := t.root.allMatches(nil)
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].less(out[j])
+	})
+	return out
+}
+
+// accepts returns true if the route going after the group routes can be merged into the group
+func (g *group) accepts(m *match) bool {
+	return g.first.priority == m.priority && g.matcher.canMerge(m.matcher)
+}
+
+// canMerge returns true if all routes of the other group going after this group can be merged into it
+func (g *group) canMerge(o *group) bool {
+	return g.first.priority == o.first.priority && g.matcher.canMerge(o.matcher)
+}
+
+// merge returns the group matching the routes of both groups, the other group goes after this one
+func (g *group) merge(o *group) (*group, error) {
+	m, err := g.matcher.merge(o.matcher)
+	if err != nil {
+		return nil, err
+	}
+	return &group{first: g.first, last: o.last, matcher: m}, nil
+}
+
+// insert returns the group with the route inserted in between the group routes
+func (g *group) insert(m *match) (*group, error) {
+	out, err := g.merge(newGroup(m))
+	if err != nil {
+		return nil, err
+	}
+	out.last = g.last
+	return out, nil
+}
+
+// remove returns the group without the route, the group has to have other routes
+func (g *group) remove(m *match) (*group, error) {
+	t, ok := g.matcher.(*trie)
+	if !ok {
+		return nil, fmt.Errorf("can't remove the route from %T", g.matcher)
+	}
+	t, err := t.remove(m.matcher)
+	if err != nil {
+		return nil, err
+	}
+	// the first route might be gone, the trie uses the mapper of the new one
+	t.mapper = t.root.first.matcher.(*trie).mapper
+
+	out := &group{first: t.root.first, last: g.last, matcher: t}
+	if m == g.last {
+		routes := out.routes()
+		out.last = routes[len(routes)-1]
+	}
+	return out, nil
+}
+
+// compile groups the ordered routes from scratch
+func compile(routes []*match) ([]*group, error) {
+	fresh := make([]*group, len(routes))
+	for i, m := range routes {
+		fresh[i] = newGroup(m)
+	}
+	return regroup(nil, fresh, nil)
+}
+
+// insertRoute returns the groups with the route added, only the group the route goes to
+// and the neighbouring groups are compiled again.
+func insertRoute(groups []*group, m *match) ([]*group, error) {
+	// the first group the route does not go after
+	i := sort.Search(len(groups), func(i int) bool {
+		return m.less(groups[i].last)
+	})
+
+	var fresh, old []*group
+	switch {
+	case i == len(groups) || m.less(groups[i].first):
+		// the route goes in between the groups
+		fresh, old = []*group{newGroup(m)}, groups[i:]
+	case groups[i].accepts(m):
+		g, err := groups[i].insert(m)
+		if err != nil {
+			return nil, err
+		}
+		fresh, old = []*group{g}, groups[i+1:]
+	default:
+		// the route splits the group, so the group is compiled again
+		routes := groups[i].routes()
+		j := sort.Search(len(routes), func(j int) bool {
+			return m.less(routes[j])
+		})
+		routes = append(routes[:j], append([]*match{m}, routes[j:]...)...)
+		for _, r := range routes {
+			fresh = append(fresh, newGroup(r))
+		}
+		old = groups[i+1:]
+	}
+
+	if i > 0 {
+		return regroup(groups[:i-1], append([]*group{groups[i-1]}, fresh...), old)
+	}
+	return regroup(nil, fresh, old)
+}
+
+// removeRoute returns the groups without the route, only the group the route belongs to
+// and the neighbouring groups are compiled again.
+func removeRoute(groups []*group, m *match) ([]*group, error) {
+	// the first group the route does not go after
+	i := sort.Search(len(groups), func(i int) bool {
+		return !groups[i].last.less(m)
+	})
+	if i == len(groups) || m.less(groups[i].first) {
+		return nil, fmt.Errorf("route '%s' is not compiled", m.expr)
+	}
+
+	var fresh []*group
+	if g := groups[i]; g.first != g.last {
+		ng, err := g.remove(m)
+		if err != nil {
+			return nil, err
+		}
+		fresh = []*group{ng}
+	}
+	if i > 0 {
+		return regroup(groups[:i-1], append([]*group{groups[i-1]}, fresh...), groups[i+1:])
+	}
+	return regroup(nil, fresh, groups[i+1:])
+}
+
+// regroup appends the fresh groups followed by the old groups to the compiled groups, merging
+// the consecutive groups when possible. The old groups are the unchanged groups compiled before,
+// once an old group can't be merged into the previous one, the rest of the old groups stays as is.
+func regroup(done, fresh, old []*group) ([]*group, error) {
+	out := append([]*group(nil), done...)
+	var acc *group
+
+	var add func(g *group) error
+	add = func(g *group) error {
+		switch {
+		case acc == nil:
+			acc = g
+		case acc.canMerge(g):
+			m, err := acc.merge(g)
+			if err != nil {
+				return err
+			}
+			acc = m
+		default:
+			out = append(out, acc)
+			acc = g
+		}
+		return nil
+	}
+
+	for _, g := range fresh {
+		if err := add(g); err != nil {
+			return nil, err
+		}
+	}
+	for i, g := range old {
+		if acc != nil && !acc.accepts(g.first) {
+			// the group is not affected by the changes, and so are the groups after it
+			return append(append(out, acc), old[i:]...), nil
+		}
+		if err := add(g); err != nil {
+			return nil, err
+		}
+	}
+	if acc != nil {
+		out = append(out, acc)
+	}
+	return out, nil
+}
+
+// matchers returns the compiled matchers of the groups
+func matchers(groups []*group) []matcher {
+	out := make([]matcher, len(groups))
+	for i, g := range groups {
+		out[i] = g.matcher
+	}
+	return out
+}
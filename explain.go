@@ -0,0 +1,133 @@
+package route
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Trace describes how the router matched the request, see Router.Explain
+type Trace struct {
+	// Steps are the matchers evaluated in the order they were evaluated in
+	Steps []TraceStep
+	// Matched is true if any route matched the request
+	Matched bool
+	// Expr is the expression of the matched route
+	Expr string
+	// Params are the values captured by the named trie patterns of the matched route
+	Params Params
+
+	// depth is the depth of the matcher being evaluated
+	depth int
+}
+
+// TraceStep describes a single matcher evaluated by the router
+type TraceStep struct {
+	// Depth is the depth of the matcher, the matchers combined with && and || operators
+	// or negated with ! operator are one level deeper than the combining matcher
+	Depth int
+	// Matcher is the kind of the matcher: trie, regexp, query, priority, and, or, not
+	Matcher string
+	// Mapper is the request property the matcher checks, e.g. Path or Host+Path
+	Mapper string
+	// Input is the request property mapped to string, as seen by the matcher
+	Input string
+	// Pattern is the regular expression of the regexp matcher or the name of the query parameter
+	Pattern string
+	// Walk is the path of the trie nodes matched while walking the trie, including
+	// the nodes of the branches the walk returned from
+	Walk []string
+	// Matched is true if the matcher matched the request
+	Matched bool
+	// Expr is the expression of the route the matcher matched
+	Expr string
+}
+
+// String returns human-readable representation of the trace
+func (t Trace) String() string {
+	b := &strings.Builder{}
+	for _, s := range t.Steps {
+		b.WriteString(strings.Repeat("  ", s.Depth))
+		b.WriteString(s.Matcher)
+		if s.Mapper != "" {
+			fmt.Fprintf(b, " %s %q", s.Mapper, s.Input)
+		}
+		if s.Pattern != "" {
+			fmt.Fprintf(b, " %q", s.Pattern)
+		}
+		if len(s.Walk) != 0 {
+			fmt.Fprintf(b, " walk %s", strings.Join(s.Walk, " "))
+		}
+		if s.Matched {
+			fmt.Fprintf(b, ": matched %s\n", s.Expr)
+		} else {
+			b.WriteString(": no match\n")
+		}
+	}
+	if !t.Matched {
+		b.WriteString("no route matched\n")
+		return b.String()
+	}
+	fmt.Fprintf(b, "route %s matched", t.Expr)
+	for i, p := range t.Params {
+		if i == 0 {
+			b.WriteString(" with")
+		}
+		fmt.Fprintf(b, " %s=%q", p.Name, p.Value)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+func (r *typedRouter[T]) Explain(req *http.Request) Trace {
+	st := &matchState{trace: &Trace{}}
+	if l := r.route(req, st); l != nil {
+		st.trace.Matched = true
+		st.trace.Expr = l.expr
+		st.trace.Params = st.params
+	}
+	return *st.trace
+}
+
+// traceInput returns the request property mapped to string, the parts of the combined
+// properties are separated by space, e.g. "localhost /v1" for Host+Path
+func traceInput(m requestMapper, r *http.Request) string {
+	s, ok := m.(*seqMapper)
+	if !ok {
+		return m.mapRequest(r)
+	}
+	parts := make([]string, len(s.seq))
+	for i := range s.seq {
+		parts[i] = s.seq[i].mapRequest(r)
+	}
+	return strings.Join(parts, " ")
+}
+
+// tracing returns true if the matchers should record the steps
+func (s *matchState) tracing() bool {
+	return s != nil && s.trace != nil
+}
+
+// begin records the step of the matcher about to evaluate the request,
+// the matchers evaluated before the end of the step are one level deeper
+func (s *matchState) begin(step TraceStep) int {
+	if !s.tracing() {
+		return -1
+	}
+	step.Depth = s.trace.depth
+	s.trace.Steps = append(s.trace.Steps, step)
+	s.trace.depth++
+	return len(s.trace.Steps) - 1
+}
+
+// end records the result of the step started by begin
+func (s *matchState) end(step int, result *match) {
+	if !s.tracing() {
+		return
+	}
+	s.trace.depth--
+	if result != nil {
+		s.trace.Steps[step].Matched = true
+		s.trace.Steps[step].Expr = result.expr
+	}
+}
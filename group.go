@@ -0,0 +1,156 @@
+package route
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Group registers the Mux routes sharing the expression prefix, see Mux.Group
+type Group struct {
+	mux    *Mux
+	prefix string
+	// parent is the group the nested group is created by, nil for the top-level groups
+	parent *Group
+
+	mutex sync.Mutex
+	// middleware wraps the handlers of the group registered after it's added, see Use
+	middleware []func(http.Handler) http.Handler
+	// exprs are the combined expressions of the routes registered by the group
+	exprs  map[string]bool
+	groups []*Group
+}
+
+// Group returns the group of routes sharing the prefix expression, the expressions
+// of the group routes are combined with the prefix as `prefixExpr && expr`, e.g.
+//
+//	api := mux.Group(`Host("api.example.com")`)
+//	api.Handle(`Path("/users")`, handler) // Host("api.example.com") && Path("/users")
+func (m *Mux) Group(prefixExpr string) *Group {
+	return &Group{mux: m, prefix: prefixExpr, exprs: make(map[string]bool)}
+}
+
+// RemoveGroup removes all the routes registered by the group and its nested groups
+func (m *Mux) RemoveGroup(g *Group) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	exprs := make([]string, 0, len(g.exprs))
+	for expr := range g.exprs {
+		exprs = append(exprs, expr)
+	}
+	sort.Strings(exprs)
+	for _, expr := range exprs {
+		if err := m.Remove(expr); err != nil {
+			return err
+		}
+		delete(g.exprs, expr)
+	}
+	for _, n := range g.groups {
+		if err := m.RemoveGroup(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Group returns the nested group, its prefix expression is combined with the prefix of this group,
+// and its handlers are wrapped with the middleware of this group, including the middleware added later
+func (g *Group) Group(prefixExpr string) *Group {
+	n := &Group{
+		mux:    g.mux,
+		prefix: combine(g.prefix, prefixExpr),
+		parent: g,
+		exprs:  make(map[string]bool),
+	}
+	g.mutex.Lock()
+	g.groups = append(g.groups, n)
+	g.mutex.Unlock()
+	return n
+}
+
+// Use adds the middleware wrapping the handlers of the group, it goes after the middleware of the Mux
+// and the parent groups, and wraps the handlers registered after the call only, see Mux.Use
+func (g *Group) Use(mw ...func(http.Handler) http.Handler) {
+	g.mutex.Lock()
+	g.middleware = append(g.middleware, mw...)
+	g.mutex.Unlock()
+}
+
+// chain returns the middleware of the parent groups followed by the middleware of the group
+func (g *Group) chain() []func(http.Handler) http.Handler {
+	var out []func(http.Handler) http.Handler
+	if g.parent != nil {
+		out = g.parent.chain()
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return append(out, g.middleware...)
+}
+
+// Handle adds http handler for route expression combined with the group prefix
+func (g *Group) Handle(expr string, handler http.Handler) error {
+	return g.HandleWith(expr, handler)
+}
+
+// HandleFunc adds http handler function for route expression combined with the group prefix
+func (g *Group) HandleFunc(expr string, handler func(http.ResponseWriter, *http.Request)) error {
+	return g.Handle(expr, http.HandlerFunc(handler))
+}
+
+// HandleWith adds http handler wrapped with the middleware for route expression combined with the group prefix,
+// the route middleware goes after the middleware of the group
+func (g *Group) HandleWith(expr string, handler http.Handler, mw ...func(http.Handler) http.Handler) error {
+	expr = combine(g.prefix, expr)
+	if err := g.mux.Handle(expr, wrap(wrap(handler, mw), g.chain())); err != nil {
+		return err
+	}
+	g.mutex.Lock()
+	g.exprs[expr] = true
+	g.mutex.Unlock()
+	return nil
+}
+
+// Remove removes the route expression combined with the group prefix
+func (g *Group) Remove(expr string) error {
+	expr = combine(g.prefix, expr)
+	if err := g.mux.Remove(expr); err != nil {
+		return err
+	}
+	g.mutex.Lock()
+	delete(g.exprs, expr)
+	g.mutex.Unlock()
+	return nil
+}
+
+// combine returns the expression matching both expressions, the expressions
+// with top-level || operator are parenthesized, as && binds tighter
+func combine(prefix, expr string) string {
+	return parenthesize(prefix) + " && " + parenthesize(expr)
+}
+
+func parenthesize(expr string) string {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == '|' && depth == 0 && strings.HasPrefix(expr[i:], "||"):
+			return "(" + expr + ")"
+		}
+	}
+	return expr
+}
@@ -2,12 +2,14 @@ package route
 
 import (
 	"fmt"
+	"strings"
 )
 
 // charPos stores the position in the iterator
 type charPos struct {
 	i  int
 	si int
+	pi int // amount of captured parameters
 }
 
 // charIter is an iterator over sequence of strings, returns byte-by-byte characters in string by string
@@ -18,6 +20,13 @@ type charIter struct {
 	seq []string // sequence of strings, e.g. ["GET", "/path"]
 	sep []byte   // every string in the sequence has an associated separator used for trie matching, e.g. path uses '/' for separator
 	// so sequence ["a.host", "/path "]has accompanying separators ['.', '/']
+
+	capturing bool   // whether the values grabbed by pattern matchers should be recorded
+	params    Params // values grabbed by pattern matchers, in order of appearance
+	levels    []int  // levels of the sequence the params are grabbed from
+
+	tracing bool     // whether the matched trie nodes should be recorded
+	walk    []string // matched trie nodes, in order of matching
 }
 
 func newIter(seq []string, sep []byte) *charIter {
@@ -47,12 +56,46 @@ func (c *charIter) isEnd() bool {
 }
 
 func (c *charIter) position() charPos {
-	return charPos{i: c.i, si: c.si}
+	return charPos{i: c.i, si: c.si, pi: len(c.params)}
 }
 
+// setPosition rewinds the iterator to the given position, dropping parameters captured after it
 func (c *charIter) setPosition(p charPos) {
 	c.i = p.i
 	c.si = p.si
+	c.params = c.params[:p.pi]
+	c.levels = c.levels[:p.pi]
+}
+
+// capture records the characters consumed since the given position as a named parameter
+func (c *charIter) capture(name string, from charPos) {
+	if !c.capturing {
+		return
+	}
+	c.params = append(c.params, Param{Name: name, Value: c.slice(from, c.position())})
+	c.levels = append(c.levels, from.si)
+}
+
+// slice returns the characters between two positions, possibly spanning several strings in the sequence
+func (c *charIter) slice(from, to charPos) string {
+	if from.si >= len(c.seq) {
+		return ""
+	}
+	if from.si == to.si {
+		return c.seq[from.si][from.i:to.i]
+	}
+	var b strings.Builder
+	for si := from.si; si <= to.si && si < len(c.seq); si++ {
+		start, end := 0, len(c.seq[si])
+		if si == from.si {
+			start = from.i
+		}
+		if si == to.si {
+			end = to.i
+		}
+		b.WriteString(c.seq[si][start:end])
+	}
+	return b.String()
 }
 
 func (c *charIter) pushBack() {
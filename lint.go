@@ -0,0 +1,600 @@
+package route
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/vulcand/predicate"
+)
+
+// LintKind is the kind of the problem found by Lint
+type LintKind string
+
+const (
+	// Unreachable route never matches, as the routes matched before it match all requests it does
+	Unreachable LintKind = "unreachable"
+	// DuplicateLeaf route ends up in the same trie leaf as the route matched before it,
+	// only the first route of the leaf is ever matched
+	DuplicateLeaf LintKind = "duplicate trie leaf"
+	// OverlappingRegexp route has a regexp matching some of the requests matched by the regexp
+	// of the route checking the same conditions before it, so the order of the routes matters
+	OverlappingRegexp LintKind = "overlapping regexp"
+)
+
+// LintIssue is the problem with the route found by Lint
+type LintIssue struct {
+	Kind LintKind
+	// Expr is the expression of the affected route
+	Expr string
+	// Alternative is the index of the affected alternative in the expression, see RouteInfo
+	Alternative int
+	// Other is the expression of the route matched before the affected route, causing the problem
+	Other string
+}
+
+func (i LintIssue) String() string {
+	switch i.Kind {
+	case Unreachable:
+		return fmt.Sprintf("route '%s' is unreachable, shadowed by '%s'", i.Expr, i.Other)
+	case DuplicateLeaf:
+		return fmt.Sprintf("route '%s' duplicates the trie leaf of '%s'", i.Expr, i.Other)
+	default:
+		return fmt.Sprintf("route '%s' has regexp overlapping with '%s'", i.Expr, i.Other)
+	}
+}
+
+func (r *typedRouter[T]) Lint() []LintIssue {
+	s := r.compiled.Load()
+	return lint(s.groups, s.routes.lookup, "")
+}
+
+// lint analyzes the compiled routes, reporting the issues with the given expression only if it's not empty,
+// in which case only the routes the alternatives of the expression are matched before are checked
+func lint(groups []*group, lookup func(string) *parsedRoute, only string) []LintIssue {
+	l := newLinter()
+	var issues []LintIssue
+	report := func(kind LintKind, m *match, other string) {
+		if only == "" || m.expr == only || other == only {
+			issues = append(issues, LintIssue{Kind: kind, Expr: m.expr, Alternative: m.alt, Other: other})
+		}
+	}
+
+	var routes []*match
+	duplicates := make(map[*match]bool)
+	for _, g := range groups {
+		routes = append(routes, g.routes()...)
+		if t, ok := g.matcher.(*trie); ok {
+			walkTrie(t.root, func(n *trieNode) {
+				for _, m := range n.matches[min(1, len(n.matches)):] {
+					if m.expr != n.matches[0].expr {
+						duplicates[m] = true
+						report(DuplicateLeaf, m, n.matches[0].expr)
+					}
+				}
+			})
+		}
+	}
+
+	clauses := func(m *match) clause {
+		return lookup(m.expr).lintClauses(m.expr)[m.alt]
+	}
+	// affected returns true if the route can have the issues caused by the alternatives of the expression
+	var alts []int
+	for i, m := range routes {
+		if m.expr == only {
+			alts = append(alts, i)
+		}
+	}
+	affected := func(i int, m *match) bool {
+		if only == "" || m.expr == only {
+			return true
+		}
+		c := clauses(m)
+		for _, j := range alts {
+			if j > i {
+				break
+			}
+			o := routes[j]
+			if oc := clauses(o); l.covers(oc, c) || (o.priority == m.priority && l.overlaps(oc, c)) {
+				return true
+			}
+		}
+		return false
+	}
+	for i, m := range routes {
+		if duplicates[m] || !affected(i, m) {
+			continue
+		}
+		c := clauses(m)
+		var overlap *match
+		unreachable := false
+		for _, o := range routes[:i] {
+			if o.expr == m.expr {
+				continue
+			}
+			oc := clauses(o)
+			if l.covers(oc, c) {
+				report(Unreachable, m, o.expr)
+				unreachable = true
+				break
+			}
+			if overlap == nil && o.priority == m.priority && l.overlaps(oc, c) {
+				overlap = o
+			}
+		}
+		if !unreachable && overlap != nil {
+			report(OverlappingRegexp, m, overlap.expr)
+		}
+	}
+	return issues
+}
+
+func walkTrie(n *trieNode, fn func(*trieNode)) {
+	if n == nil {
+		return
+	}
+	fn(n)
+	for _, c := range n.children {
+		walkTrie(c, fn)
+	}
+}
+
+// lintClauses returns the clauses of the route alternatives, parsing them on the first call
+func (p *parsedRoute) lintClauses(expr string) []clause {
+	p.clausesOnce.Do(func() {
+		// the expression has been parsed by the router, so it's valid
+		p.clauses, _ = parseClauses(expr)
+	})
+	return p.clauses
+}
+
+// condition is a single check of the request property made by the route
+type condition struct {
+	// kind is trie, regexp, exists or not
+	kind   string
+	mapper requestMapper
+	value  string
+	// negated are the clauses of the not condition
+	negated []clause
+}
+
+// clause is the list of the conditions checked by the route alternative
+type clause []*condition
+
+// parseClauses parses the route expression into the clauses, one per alternative in the same order
+// as the alternatives compiled by the router, see alternatives
+func parseClauses(expr string) ([]clause, error) {
+	cond := func(kind string, mapper requestMapper, value string) []clause {
+		return []clause{{{kind: kind, mapper: mapper, value: value}}}
+	}
+	p, err := predicate.NewParser(predicate.Def{
+		Functions: map[string]interface{}{
+			"Priority": func(int) []clause { return []clause{{}} },
+
+			"Host":       func(v string) []clause { return cond("trie", &hostMapper{}, strings.ToLower(v)) },
+			"HostRegexp": func(v string) []clause { return cond("regexp", &hostMapper{}, strings.ToLower(v)) },
+
+			"Path": func(v string) []clause {
+				// the optional parts of the path expand into the alternatives, as the router does
+				paths, err := expandPattern(v)
+				if err != nil {
+					return cond("trie", &pathMapper{}, v)
+				}
+				var out []clause
+				for _, p := range paths {
+					out = append(out, cond("trie", &pathMapper{}, p)...)
+				}
+				return out
+			},
+			"PathRegexp": func(v string) []clause { return cond("regexp", &pathMapper{}, v) },
+
+			"Method":       func(v string) []clause { return cond("trie", &methodMapper{}, v) },
+			"MethodRegexp": func(v string) []clause { return cond("regexp", &methodMapper{}, v) },
+
+			"Header":       func(n, v string) []clause { return cond("trie", &headerMapper{header: n}, v) },
+			"HeaderRegexp": func(n, v string) []clause { return cond("regexp", &headerMapper{header: n}, v) },
+
+			"Query":       func(n, v string) []clause { return cond("trie", &queryMapper{name: n}, v) },
+			"QueryRegexp": func(n, v string) []clause { return cond("regexp", &queryMapper{name: n}, v) },
+			"QueryExists": func(n string) []clause { return cond("exists", &queryMapper{name: n}, "") },
+		},
+		Operators: predicate.Operators{
+			AND: func(a, b []clause) []clause {
+				var out []clause
+				for _, x := range a {
+					for _, y := range b {
+						out = append(out, append(append(clause{}, x...), y...))
+					}
+				}
+				return out
+			},
+			OR: func(a, b []clause) []clause {
+				return append(append([]clause{}, a...), b...)
+			},
+			NOT: func(a []clause) []clause {
+				return []clause{{{kind: "not", value: fmt.Sprint(a), negated: a}}}
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	out, err := p.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	clauses, ok := out.([]clause)
+	if !ok {
+		return nil, fmt.Errorf("unknown result type: %T", out)
+	}
+	return clauses, nil
+}
+
+func (c *condition) String() string {
+	return fmt.Sprintf("%s(%v, %q)", c.kind, c.mapper, c.value)
+}
+
+func (c *condition) sameProperty(o *condition) bool {
+	return c.mapper != nil && o.mapper != nil && c.mapper.String() == o.mapper.String()
+}
+
+// prefix returns the literal prefix of the values matched by the condition
+func (c *condition) prefix() string {
+	if c.kind != "trie" {
+		return ""
+	}
+	if i := strings.IndexByte(c.value, '<'); i != -1 {
+		return c.value[:i]
+	}
+	return c.value
+}
+
+func (c *condition) isLiteral() bool {
+	return c.kind == "trie" && !strings.Contains(c.value, "<")
+}
+
+// linter compares the conditions of the routes, the tries and regexps of the conditions
+// are compiled once per lint run, as every route is compared with many others
+type linter struct {
+	keys    map[*condition]string
+	tries   map[*condition]*trie
+	regexps map[*condition]*regexp.Regexp
+	progs   map[*condition]*syntax.Prog
+	suffix  map[*condition]bool
+}
+
+func newLinter() *linter {
+	return &linter{
+		keys:    make(map[*condition]string),
+		tries:   make(map[*condition]*trie),
+		regexps: make(map[*condition]*regexp.Regexp),
+		progs:   make(map[*condition]*syntax.Prog),
+		suffix:  make(map[*condition]bool),
+	}
+}
+
+func (l *linter) key(c *condition) string {
+	k, ok := l.keys[c]
+	if !ok {
+		k = c.String()
+		l.keys[c] = k
+	}
+	return k
+}
+
+func (l *linter) equals(c, o *condition) bool {
+	return c == o || l.key(c) == l.key(o)
+}
+
+// trie returns the trie of the condition, nil if it can't be compiled
+func (l *linter) trie(c *condition) *trie {
+	t, ok := l.tries[c]
+	if !ok {
+		t, _ = newTrieMatcher(c.value, c.mapper, &match{})
+		l.tries[c] = t
+	}
+	return t
+}
+
+// regexp returns the regexp of the condition, nil if it can't be compiled
+func (l *linter) regexp(c *condition) *regexp.Regexp {
+	re, ok := l.regexps[c]
+	if !ok {
+		re, _ = regexp.Compile(c.value)
+		l.regexps[c] = re
+	}
+	return re
+}
+
+// prog returns the regexp program of the condition, nil if it can't be compiled
+func (l *linter) prog(c *condition) *syntax.Prog {
+	p, ok := l.progs[c]
+	if !ok {
+		p, _ = compileProg(c.value)
+		l.progs[c] = p
+	}
+	return p
+}
+
+func (l *linter) checksSuffix(c *condition) bool {
+	v, ok := l.suffix[c]
+	if !ok {
+		v = checksSuffix(c.value)
+		l.suffix[c] = v
+	}
+	return v
+}
+
+// coversCondition returns true if the condition holds for all requests the other condition holds for
+func (l *linter) coversCondition(c, o *condition) bool {
+	if l.equals(c, o) {
+		return true
+	}
+	if !c.sameProperty(o) {
+		return false
+	}
+	switch c.kind {
+	case "trie":
+		// the literal prefix rules out most of the values without walking the trie
+		if !o.isLiteral() || !strings.HasPrefix(o.value, c.prefix()) {
+			return false
+		}
+		t := l.trie(c)
+		if t == nil {
+			return false
+		}
+		search := &trieSearch{}
+		t.root.match(newIter([]string{o.value}, []byte{c.mapper.separator()}), search)
+		return search.best != nil
+	case "regexp":
+		re := l.regexp(c)
+		if re == nil {
+			return false
+		}
+		if o.isLiteral() {
+			return re.MatchString(o.value)
+		}
+		// the regexp matching the prefix matches the values starting with the prefix as well,
+		// unless it checks what goes after the match
+		return re.MatchString(o.prefix()) && !l.checksSuffix(c)
+	case "exists":
+		return o.prefix() != ""
+	}
+	return false
+}
+
+// covers returns true if the clause holds for all requests the other clause holds for
+func (l *linter) covers(c, o clause) bool {
+	for _, x := range c {
+		covered := false
+		for _, y := range o {
+			if l.coversCondition(x, y) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// overlaps returns true if the clauses check the same conditions, except for the regexps
+// on the same request property, that match some of the same values
+func (l *linter) overlaps(c, o clause) bool {
+	if len(c) != len(o) {
+		return false
+	}
+	regexps := 0
+	for _, x := range c {
+		found := false
+		for _, y := range o {
+			if l.equals(x, y) {
+				found = true
+				break
+			}
+			if x.kind == "regexp" && y.kind == "regexp" && x.sameProperty(y) && progsOverlap(l.prog(x), l.prog(y)) {
+				found = true
+				regexps++
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return regexps != 0
+}
+
+// checksSuffix returns true if the regexp has the assertions depending on what goes after the match, e.g. $
+func checksSuffix(expr string) bool {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return true
+	}
+	var check func(*syntax.Regexp) bool
+	check = func(re *syntax.Regexp) bool {
+		switch re.Op {
+		case syntax.OpEndLine, syntax.OpEndText, syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+			return true
+		}
+		for _, s := range re.Sub {
+			if check(s) {
+				return true
+			}
+		}
+		return false
+	}
+	return check(re)
+}
+
+// regexpsOverlap returns true if there's a string matched by both regular expressions,
+// it walks the product of the regexp programs looking for the string. The walk considers
+// a few representative characters only, so it may miss the overlaps relying on the rare characters.
+func regexpsOverlap(a, b string) bool {
+	pa, err := compileProg(a)
+	if err != nil {
+		return false
+	}
+	pb, err := compileProg(b)
+	if err != nil {
+		return false
+	}
+	return progsOverlap(pa, pb)
+}
+
+// progsOverlap works like regexpsOverlap for the compiled regexp programs, nil programs never overlap
+func progsOverlap(pa, pb *syntax.Prog) bool {
+	if pa == nil || pb == nil {
+		return false
+	}
+
+	type state struct {
+		a, b int
+		// prev is the character representing the class of the previous character, see EmptyOpContext
+		prev rune
+	}
+	start := state{a: progIdle, b: progIdle, prev: -1}
+	visited := map[state]bool{start: true}
+	queue := []state{start}
+	for len(queue) != 0 {
+		s := queue[0]
+		queue = queue[1:]
+
+		for _, c := range append(overlapCandidates(pa, s.a, pb, s.b), -1) {
+			flags := syntax.EmptyOpContext(s.prev, c)
+			as, bs := progClosure(pa, s.a, flags), progClosure(pb, s.b, flags)
+			if as[progDone] && bs[progDone] {
+				return true
+			}
+			if c == -1 {
+				continue
+			}
+			for x := range as {
+				nx := progStep(pa, x, c)
+				if nx == progFail {
+					continue
+				}
+				for y := range bs {
+					ny := progStep(pb, y, c)
+					if ny == progFail {
+						continue
+					}
+					next := state{a: nx, b: ny, prev: runeClass(c)}
+					if !visited[next] {
+						visited[next] = true
+						queue = append(queue, next)
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+const (
+	// progIdle is the state of the search before the regexp starts matching
+	progIdle = -1
+	// progDone is the state of the search after the regexp has matched
+	progDone = -2
+	progFail = -3
+)
+
+func compileProg(expr string) (*syntax.Prog, error) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	return syntax.Compile(re.Simplify())
+}
+
+// progClosure returns the states reachable from the state without consuming a character
+func progClosure(p *syntax.Prog, s int, flags syntax.EmptyOp) map[int]bool {
+	out := make(map[int]bool)
+	var add func(s int)
+	add = func(s int) {
+		if out[s] {
+			return
+		}
+		out[s] = true
+		if s < 0 {
+			if s == progIdle {
+				add(p.Start)
+			}
+			return
+		}
+		i := &p.Inst[s]
+		switch i.Op {
+		case syntax.InstAlt, syntax.InstAltMatch:
+			add(int(i.Out))
+			add(int(i.Arg))
+		case syntax.InstCapture, syntax.InstNop:
+			add(int(i.Out))
+		case syntax.InstEmptyWidth:
+			if syntax.EmptyOp(i.Arg)&^flags == 0 {
+				add(int(i.Out))
+			}
+		case syntax.InstMatch:
+			add(progDone)
+		}
+	}
+	add(s)
+	return out
+}
+
+// progStep returns the state after consuming the character
+func progStep(p *syntax.Prog, s int, c rune) int {
+	if s < 0 {
+		return s
+	}
+	i := &p.Inst[s]
+	switch i.Op {
+	case syntax.InstRune, syntax.InstRune1:
+		if i.MatchRune(c) {
+			return int(i.Out)
+		}
+	case syntax.InstRuneAny:
+		return int(i.Out)
+	case syntax.InstRuneAnyNotNL:
+		if c != '\n' {
+			return int(i.Out)
+		}
+	}
+	return progFail
+}
+
+// overlapCandidates returns the characters worth trying in the given states: the bounds of the character ranges
+// expected by the both programs, one of which is in the intersection of the ranges if there's any,
+// and the characters representing every class of characters
+func overlapCandidates(pa *syntax.Prog, a int, pb *syntax.Prog, b int) []rune {
+	out := []rune{'a', '-', '\n', '/'}
+	for _, p := range []struct {
+		prog *syntax.Prog
+		s    int
+	}{{pa, a}, {pb, b}} {
+		for s := range progClosure(p.prog, p.s, ^syntax.EmptyOp(0)) {
+			if s < 0 {
+				continue
+			}
+			if i := &p.prog.Inst[s]; i.Op == syntax.InstRune || i.Op == syntax.InstRune1 {
+				out = append(out, i.Rune...)
+			}
+		}
+	}
+	return out
+}
+
+// runeClass returns the character representing the class of the character for the empty-width assertions
+func runeClass(c rune) rune {
+	switch {
+	case c == '\n':
+		return '\n'
+	case syntax.IsWordChar(c):
+		return 'a'
+	default:
+		return '-'
+	}
+}
@@ -0,0 +1,201 @@
+package route
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type LintSuite struct {
+	suite.Suite
+}
+
+func TestLintSuite(t *testing.T) {
+	suite.Run(t, new(LintSuite))
+}
+
+func (s *LintSuite) TestNoIssues() {
+	r := New()
+	s.Nil(r.AddRoute(`Path("/a")`, "a"))
+	s.Nil(r.AddRoute(`Path("/b/<int:id>")`, "b"))
+	s.Nil(r.AddRoute(`Host("localhost") && PathRegexp("^/c$")`, "c"))
+	s.Nil(r.AddRoute(`PathRegexp("^/d$")`, "d"))
+	s.Empty(r.Lint())
+}
+
+func (s *LintSuite) TestUnreachable() {
+	r := New()
+	s.Nil(r.AddRouteWithOptions(`PathRegexp("/.*")`, "all", RouteOptions{Priority: 1}))
+	s.Nil(r.AddRoute(`Host("localhost") && Path("/users/<int:id>")`, "user"))
+	s.Nil(r.AddRoute(`Method("GET") || Path("/b")`, "get"))
+	s.Nil(r.AddRoute(`Host("api.localhost") && Method("POST") && Path("/a")`, "api"))
+
+	s.Equal([]LintIssue{
+		{Kind: Unreachable, Expr: `Host("api.localhost") && Method("POST") && Path("/a")`, Other: `PathRegexp("/.*")`},
+		{Kind: Unreachable, Expr: `Host("localhost") && Path("/users/<int:id>")`, Other: `PathRegexp("/.*")`},
+		{Kind: Unreachable, Expr: `Method("GET") || Path("/b")`, Alternative: 1, Other: `PathRegexp("/.*")`},
+	}, r.Lint())
+
+	s.Nil(r.RemoveRoute(`PathRegexp("/.*")`))
+	s.Nil(r.AddRouteWithOptions(`Host("<sub>.localhost") && Method("POST")`, "post", RouteOptions{Priority: 1}))
+	s.Equal([]LintIssue{
+		{Kind: Unreachable, Expr: `Host("api.localhost") && Method("POST") && Path("/a")`, Other: `Host("<sub>.localhost") && Method("POST")`},
+	}, r.Lint())
+}
+
+func (s *LintSuite) TestDuplicateLeaf() {
+	r := New()
+	s.Nil(r.AddRoute(`Path("/a") || Path("/b")`, "ab"))
+	s.Nil(r.AddRoute(`Path("/b") || Path("/c")`, "bc"))
+
+	issues := r.Lint()
+	s.Equal([]LintIssue{
+		{Kind: DuplicateLeaf, Expr: `Path("/a") || Path("/b")`, Alternative: 1, Other: `Path("/b") || Path("/c")`},
+	}, issues)
+	s.Equal(`route 'Path("/a") || Path("/b")' duplicates the trie leaf of 'Path("/b") || Path("/c")'`, issues[0].String())
+}
+
+func (s *LintSuite) TestOverlappingRegexps() {
+	r := New()
+	s.Nil(r.AddRoute(`Host("localhost") && PathRegexp("^/api/")`, "api"))
+	s.Nil(r.AddRoute(`Host("localhost") && PathRegexp("^/api/v1/users$")`, "users"))
+	s.Nil(r.AddRoute(`Host("localhost") && PathRegexp("^/web/")`, "web"))
+	s.Nil(r.AddRoute(`Host("example.com") && PathRegexp("^/api/v2/")`, "v2"))
+
+	s.Equal([]LintIssue{
+		{Kind: OverlappingRegexp, Expr: `Host("localhost") && PathRegexp("^/api/")`, Other: `Host("localhost") && PathRegexp("^/api/v1/users$")`},
+	}, r.Lint())
+}
+
+func (s *LintSuite) TestStrict() {
+	r := New()
+	s.Nil(r.AddRouteWithOptions(`PathRegexp("/.*")`, "all", RouteOptions{Priority: 1}))
+	s.Nil(r.AddRouteWithOptions(`Method("GET")`, "get", RouteOptions{Strict: true}))
+
+	err := r.AddRouteWithOptions(`Path("/b")`, "b", RouteOptions{Strict: true})
+	s.EqualError(err, `expression 'Path("/b")' is rejected: route 'Path("/b")' is unreachable, shadowed by 'PathRegexp("/.*")'`)
+	s.Nil(r.GetRoute(`Path("/b")`))
+
+	out, err := r.Route(makeReq(req{url: "/b"}))
+	s.Nil(err)
+	s.Equal("all", out)
+
+	// the transactions check the strict routes against the other routes of the transaction
+	err = r.Update(func(tx Tx) error {
+		tx.Add(`Path("/c")`, "c")
+		tx.AddWithOptions(`Path("/d")`, "d", RouteOptions{Strict: true})
+		return nil
+	})
+	s.EqualError(err, `expression 'Path("/d")' is rejected: route 'Path("/d")' is unreachable, shadowed by 'PathRegexp("/.*")'`)
+	s.Nil(r.GetRoute(`Path("/c")`))
+
+	s.Nil(r.Update(func(tx Tx) error {
+		tx.Remove(`PathRegexp("/.*")`)
+		tx.AddWithOptions(`Path("/d")`, "d", RouteOptions{Strict: true})
+		return nil
+	}))
+	s.Equal("d", r.GetRoute(`Path("/d")`))
+}
+
+func (s *LintSuite) TestLintOnly() {
+	r := newTypedRouter[interface{}]()
+	for _, expr := range []string{
+		`Host("localhost") && PathRegexp("^/api/")`,
+		`Host("localhost") && PathRegexp("^/api/v1/users$")`,
+		`Host("localhost") && Path("/users/<int:id>")`,
+		`Host("<sub>.localhost") && Method("POST")`,
+		`Host("api.localhost") && Method("POST") && Path("/a")`,
+		`Path("/a") || Path("/b")`,
+		`Path("/b") || Path("/c")`,
+		`Method("GET") || Path("/b")`,
+	} {
+		s.Nil(r.AddRoute(expr, expr))
+	}
+	all := r.Lint()
+	s.NotEmpty(all)
+
+	// the strict check compares the expression with the other routes only, but finds the same issues
+	snap := r.compiled.Load()
+	snap.routes.each(func(expr string, _ *parsedRoute) {
+		var expected []LintIssue
+		for _, issue := range all {
+			if issue.Expr == expr || issue.Other == expr {
+				expected = append(expected, issue)
+			}
+		}
+		s.Equal(expected, lint(snap.groups, snap.routes.lookup, expr), expr)
+	})
+}
+
+func (s *LintSuite) TestParseClauses() {
+	clauses, err := parseClauses(`(Host("A") || !Method("GET")) && Priority(1) && Path("/a")`)
+	s.Require().NoError(err)
+	s.Require().Len(clauses, 2)
+	s.Equal(`[trie(Host, "a") trie(Path, "/a")]`, fmtClause(clauses[0]))
+	s.Equal(`[not(<nil>, "[[trie(Method, \"GET\")]]") trie(Path, "/a")]`, fmtClause(clauses[1]))
+}
+
+func (s *LintSuite) TestRegexpsOverlap() {
+	tc := []struct {
+		a, b     string
+		expected bool
+	}{
+		{a: `^/api/`, b: `^/api/v1/users$`, expected: true},
+		{a: `^/a$`, b: `^/b$`, expected: false},
+		{a: `^/a`, b: `/b$`, expected: true},
+		{a: `^\d+$`, b: `^[a-z]+$`, expected: false},
+		{a: `^[0-9a-f]+$`, b: `^[g-z0-5]+$`, expected: true},
+		{a: `^(?i)GET$`, b: `^get$`, expected: true},
+		{a: `^a\b`, b: `^ab`, expected: false},
+		{a: `^a\b`, b: `^a-`, expected: true},
+		{a: `x`, b: `y`, expected: true},
+	}
+	for _, t := range tc {
+		s.Equal(t.expected, regexpsOverlap(t.a, t.b), "%s and %s", t.a, t.b)
+		s.Equal(t.expected, regexpsOverlap(t.b, t.a), "%s and %s", t.b, t.a)
+	}
+}
+
+func fmtClause(c clause) string {
+	out := "["
+	for i, cond := range c {
+		if i > 0 {
+			out += " "
+		}
+		out += cond.String()
+	}
+	return out + "]"
+}
+
+func BenchmarkLint(b *testing.B) {
+	r := New()
+	for i := 0; i < 2000; i++ {
+		if err := r.AddRoute(fmt.Sprintf(`Host("h%d.example.com") && PathRegexp("^/p%d/")`, i, i), i); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Lint()
+	}
+}
+
+func BenchmarkStrictUpsert(b *testing.B) {
+	r := New()
+	for i := 0; i < 2000; i++ {
+		if err := r.AddRoute(fmt.Sprintf(`Host("h%d.example.com") && PathRegexp("^/p%d/")`, i, i), i); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		expr := fmt.Sprintf(`Host("new.example.com") && PathRegexp("^/n%d/")`, i)
+		if err := r.AddRouteWithOptions(expr, i, RouteOptions{Strict: true}); err != nil {
+			b.Fatal(err)
+		}
+		if err := r.RemoveRoute(expr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package route
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 )
@@ -9,6 +10,7 @@ const (
 	pathSep   = '/'
 	domainSep = '.'
 	headerSep = '/'
+	querySep  = '/'
 	methodSep = ' '
 )
 
@@ -23,10 +25,16 @@ type requestMapper interface {
 	mapRequest(r *http.Request) string
 	// newIter returns the iterator instead of string for stream matchers
 	newIter(r *http.Request) *charIter
+	// String returns the name of the mapped request property, e.g. Path
+	String() string
 }
 
 type methodMapper struct{}
 
+func (m *methodMapper) String() string {
+	return "Method"
+}
+
 func (m *methodMapper) separator() byte {
 	return methodSep
 }
@@ -49,6 +57,10 @@ func (m *methodMapper) newIter(r *http.Request) *charIter {
 
 type pathMapper struct{}
 
+func (p *pathMapper) String() string {
+	return "Path"
+}
+
 func (p *pathMapper) separator() byte {
 	return pathSep
 }
@@ -79,6 +91,10 @@ func (h *hostMapper) equivalent(o requestMapper) requestMapper {
 	return nil
 }
 
+func (h *hostMapper) String() string {
+	return "Host"
+}
+
 func (h *hostMapper) separator() byte {
 	return domainSep
 }
@@ -103,6 +119,10 @@ func (h *headerMapper) equivalent(o requestMapper) requestMapper {
 	return nil
 }
 
+func (h *headerMapper) String() string {
+	return fmt.Sprintf("Header(%s)", h.header)
+}
+
 func (h *headerMapper) separator() byte {
 	return headerSep
 }
@@ -115,10 +135,47 @@ func (h *headerMapper) newIter(r *http.Request) *charIter {
 	return newIter([]string{h.mapRequest(r)}, []byte{h.separator()})
 }
 
+// queryMapper maps the request to the value of the URL query parameter
+type queryMapper struct {
+	name string
+}
+
+func (q *queryMapper) equivalent(o requestMapper) requestMapper {
+	qm, ok := o.(*queryMapper)
+	if ok && qm.name == q.name {
+		return q
+	}
+	return nil
+}
+
+func (q *queryMapper) String() string {
+	return fmt.Sprintf("Query(%s)", q.name)
+}
+
+func (q *queryMapper) separator() byte {
+	return querySep
+}
+
+func (q *queryMapper) mapRequest(r *http.Request) string {
+	return r.URL.Query().Get(q.name)
+}
+
+func (q *queryMapper) newIter(r *http.Request) *charIter {
+	return newIter([]string{q.mapRequest(r)}, []byte{q.separator()})
+}
+
 type seqMapper struct {
 	seq []requestMapper
 }
 
+// levelMapper returns the mapper of the given level of the sequence the mapper iterates over
+func levelMapper(m requestMapper, level int) requestMapper {
+	if s, ok := m.(*seqMapper); ok && level < len(s.seq) {
+		return s.seq[level]
+	}
+	return m
+}
+
 func newSeqMapper(seq ...requestMapper) *seqMapper {
 	var out []requestMapper
 	for _, s := range seq {
@@ -152,6 +209,14 @@ func (s *seqMapper) mapRequest(r *http.Request) string {
 	return strings.Join(out, "")
 }
 
+func (s *seqMapper) String() string {
+	names := make([]string, len(s.seq))
+	for i := range s.seq {
+		names[i] = s.seq[i].String()
+	}
+	return strings.Join(names, "+")
+}
+
 func (s *seqMapper) separator() byte {
 	return s.seq[0].separator()
 }
@@ -171,11 +236,8 @@ func (s *seqMapper) equivalent(o requestMapper) requestMapper {
 		shorter = s
 	}
 
-	for i := range longer.seq {
-		// shorter is subset of longer, return longer sequence mapper
-		if i >= len(shorter.seq)-1 {
-			return longer
-		}
+	// shorter has to be a prefix of longer, e.g. (host, path) and (host, path, header)
+	for i := range shorter.seq {
 		if longer.seq[i].equivalent(shorter.seq[i]) == nil {
 			return nil
 		}
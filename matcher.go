@@ -9,7 +9,8 @@ import (
 )
 
 type matcher interface {
-	match(*http.Request) *match
+	// match returns the matched result or nil, st collects per-request data and may be nil
+	match(req *http.Request, st *matchState) *match
 	setMatch(match *match)
 
 	canMerge(matcher) bool
@@ -21,6 +22,69 @@ type matcher interface {
 
 type match struct {
 	val interface{}
+	// routes with higher priority are matched first
+	priority int
+	// expr and alt identify the alternative of the route expression the match belongs to
+	expr string
+	alt  int
+	// matcher is the own matcher of the alternative, before it's merged with other routes
+	matcher matcher
+	// conditions is the amount of request properties checked by the alternative, see conditions
+	conditions int
+}
+
+// less defines the order the routes are matched in:
+//   - routes with higher priority go first
+//   - routes checking more conditions go first, e.g. Host("h") && PathRegexp("/.*") goes before Path("/a")
+//   - trie-based routes go before the regexp-based and other routes checking the same amount of conditions
+//   - the rest of the routes are ordered by expression in reverse lexicographic order,
+//     which keeps the similar expressions next to each other so they can be merged into one trie
+func (m *match) less(o *match) bool {
+	if m.priority != o.priority {
+		return m.priority > o.priority
+	}
+	if m.conditions != o.conditions {
+		return m.conditions > o.conditions
+	}
+	_, mTrie := m.matcher.(*trie)
+	_, oTrie := o.matcher.(*trie)
+	if mTrie != oTrie {
+		return mTrie
+	}
+	if m.expr != o.expr {
+		return m.expr > o.expr
+	}
+	return m.alt < o.alt
+}
+
+// matchState holds the data collected while matching a single request,
+// e.g. parameters captured by trie patterns. Matchers accept nil state
+// when the caller is interested in the matched result only.
+type matchState struct {
+	params Params
+	// escaped are the indexes of the params captured from the path with escape symbols, see pathValue
+	escaped []int
+	// trace records the evaluated matchers if not nil, see Router.Explain
+	trace *Trace
+}
+
+// mark returns the current state that can be restored with rollback
+func (s *matchState) mark() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.params)
+}
+
+// rollback drops the data collected after the mark
+func (s *matchState) rollback(mark int) {
+	if s == nil {
+		return
+	}
+	s.params = s.params[:mark]
+	for len(s.escaped) != 0 && s.escaped[len(s.escaped)-1] >= mark {
+		s.escaped = s.escaped[:len(s.escaped)-1]
+	}
 }
 
 func hostTrieMatcher(hostname string) (matcher, error) {
@@ -39,8 +103,26 @@ func methodRegexpMatcher(method string) (matcher, error) {
 	return newRegexpMatcher(method, &methodMapper{}, &match{})
 }
 
+// pathTrieMatcher returns the trie matching the path, the pattern with the optional parts
+// expands into the alternatives, so every one of them can be merged with the other tries
 func pathTrieMatcher(path string) (matcher, error) {
-	return newTrieMatcher(path, &pathMapper{}, &match{})
+	paths, err := expandPattern(path)
+	if err != nil {
+		return nil, err
+	}
+	var out matcher
+	for _, p := range paths {
+		t, err := newTrieMatcher(p, &pathMapper{}, &match{})
+		if err != nil {
+			return nil, err
+		}
+		if out == nil {
+			out = t
+		} else {
+			out = newOrMatcher(out, t)
+		}
+	}
+	return out, nil
 }
 
 func pathRegexpMatcher(path string) (matcher, error) {
@@ -55,12 +137,41 @@ func headerRegexpMatcher(name, value string) (matcher, error) {
 	return newRegexpMatcher(value, &headerMapper{header: name}, &match{})
 }
 
+func queryTrieMatcher(name, value string) (matcher, error) {
+	return newTrieMatcher(value, &queryMapper{name: name}, &match{})
+}
+
+func queryRegexpMatcher(name, value string) (matcher, error) {
+	return newRegexpMatcher(value, &queryMapper{name: name}, &match{})
+}
+
+func queryExistsMatcher(name string) (matcher, error) {
+	return &queryMatcher{name: name}, nil
+}
+
 type andMatcher struct {
 	a matcher
 	b matcher
+	// result is kept by the matcher, as the matchers can be shared by the alternatives, e.g. C in (A || B) && C
+	result *match
 }
 
 func newAndMatcher(a, b matcher) matcher {
+	// Priority does not take part in matching, so it should not prevent chaining
+	if _, ok := a.(*priorityMatcher); ok {
+		return b
+	}
+	if _, ok := b.(*priorityMatcher); ok {
+		return a
+	}
+	// Distribute over alternatives, (A || B) && C becomes A && C || B && C,
+	// so every alternative gets a chance to be chained into a single trie
+	if o, ok := a.(*orMatcher); ok {
+		return newOrMatcher(newAndMatcher(o.a, b), newAndMatcher(o.b, b))
+	}
+	if o, ok := b.(*orMatcher); ok {
+		return newOrMatcher(newAndMatcher(a, o.a), newAndMatcher(a, o.b))
+	}
 	if a.canChain(b) {
 		m, err := a.chain(b)
 		if err == nil {
@@ -87,6 +198,7 @@ func (a *andMatcher) String() string {
 func (a *andMatcher) setMatch(m *match) {
 	a.a.setMatch(m)
 	a.b.setMatch(m)
+	a.result = m
 }
 
 func (a *andMatcher) canMerge(_ matcher) bool {
@@ -97,12 +209,221 @@ func (a *andMatcher) merge(_ matcher) (matcher, error) {
 	return nil, errors.New("method not supported")
 }
 
-func (a *andMatcher) match(req *http.Request) *match {
-	result := a.a.match(req)
-	if result == nil {
+func (a *andMatcher) match(req *http.Request, st *matchState) *match {
+	step := st.begin(TraceStep{Matcher: "and"})
+	mark := st.mark()
+	if a.a.match(req, st) == nil || a.b.match(req, st) == nil {
+		st.rollback(mark)
+		st.end(step, nil)
 		return nil
 	}
-	return a.b.match(req)
+	st.end(step, a.result)
+	return a.result
+}
+
+// orMatcher matches if any of the alternatives matches, alternatives are tried in order
+type orMatcher struct {
+	a matcher
+	b matcher
+}
+
+func newOrMatcher(a, b matcher) matcher {
+	return &orMatcher{
+		a: a, b: b,
+	}
+}
+
+func (o *orMatcher) canChain(matcher) bool {
+	return false
+}
+
+func (o *orMatcher) chain(matcher) (matcher, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (o *orMatcher) String() string {
+	return fmt.Sprintf("orMatcher(%v, %v)", o.a, o.b)
+}
+
+func (o *orMatcher) setMatch(m *match) {
+	o.a.setMatch(m)
+	o.b.setMatch(m)
+}
+
+func (o *orMatcher) canMerge(_ matcher) bool {
+	return false
+}
+
+func (o *orMatcher) merge(_ matcher) (matcher, error) {
+	return nil, errors.New("method not supported")
+}
+
+func (o *orMatcher) match(req *http.Request, st *matchState) *match {
+	step := st.begin(TraceStep{Matcher: "or"})
+	result := o.a.match(req, st)
+	if result == nil {
+		result = o.b.match(req, st)
+	}
+	st.end(step, result)
+	return result
+}
+
+// notMatcher matches if the negated matcher does not match.
+// It never chains or merges with other matchers, so it is matched separately.
+type notMatcher struct {
+	m      matcher
+	result *match
+}
+
+func newNotMatcher(m matcher) matcher {
+	return &notMatcher{m: m}
+}
+
+func (n *notMatcher) canChain(matcher) bool {
+	return false
+}
+
+func (n *notMatcher) chain(matcher) (matcher, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (n *notMatcher) String() string {
+	return fmt.Sprintf("notMatcher(%v)", n.m)
+}
+
+func (n *notMatcher) setMatch(m *match) {
+	n.m.setMatch(m)
+	n.result = m
+}
+
+func (n *notMatcher) canMerge(_ matcher) bool {
+	return false
+}
+
+func (n *notMatcher) merge(_ matcher) (matcher, error) {
+	return nil, errors.New("method not supported")
+}
+
+func (n *notMatcher) match(req *http.Request, st *matchState) *match {
+	step := st.begin(TraceStep{Matcher: "not"})
+	// values captured by the negated matcher are never exposed
+	var inner *matchState
+	if st.tracing() {
+		inner = &matchState{trace: st.trace}
+	}
+	result := n.result
+	if n.m.match(req, inner) != nil {
+		result = nil
+	}
+	st.end(step, result)
+	return result
+}
+
+// priorityMatcher is produced by Priority(n) pseudo-function and matches any request,
+// it is dropped when combined with other matchers using && operator
+type priorityMatcher struct {
+	result *match
+}
+
+func (p *priorityMatcher) canChain(matcher) bool {
+	return false
+}
+
+func (p *priorityMatcher) chain(matcher) (matcher, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (p *priorityMatcher) String() string {
+	return "priorityMatcher()"
+}
+
+func (p *priorityMatcher) setMatch(result *match) {
+	p.result = result
+}
+
+func (p *priorityMatcher) canMerge(matcher) bool {
+	return false
+}
+
+func (p *priorityMatcher) merge(matcher) (matcher, error) {
+	return nil, errors.New("method not supported")
+}
+
+func (p *priorityMatcher) match(_ *http.Request, st *matchState) *match {
+	st.end(st.begin(TraceStep{Matcher: "priority"}), p.result)
+	return p.result
+}
+
+// alternatives returns the list of matchers that are combined with || operator,
+// router compiles every alternative separately, so tries can be merged with other routes
+func alternatives(m matcher) []matcher {
+	o, ok := m.(*orMatcher)
+	if !ok {
+		return []matcher{m}
+	}
+	return append(alternatives(o.a), alternatives(o.b)...)
+}
+
+// conditions returns the amount of request properties checked by the matcher,
+// e.g. Host("localhost") && Path("/v1") checks two conditions
+func conditions(m matcher) int {
+	switch t := m.(type) {
+	case *andMatcher:
+		return conditions(t.a) + conditions(t.b)
+	case *orMatcher:
+		return min(conditions(t.a), conditions(t.b))
+	case *notMatcher:
+		return conditions(t.m)
+	case *priorityMatcher:
+		return 0
+	case *trie:
+		if seq, ok := t.mapper.(*seqMapper); ok {
+			return len(seq.seq)
+		}
+		return 1
+	default:
+		return 1
+	}
+}
+
+// queryMatcher matches if the URL query parameter is present, regardless of its value
+type queryMatcher struct {
+	name   string
+	result *match
+}
+
+func (q *queryMatcher) canChain(matcher) bool {
+	return false
+}
+
+func (q *queryMatcher) chain(matcher) (matcher, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (q *queryMatcher) String() string {
+	return fmt.Sprintf("queryMatcher(%v)", q.name)
+}
+
+func (q *queryMatcher) setMatch(result *match) {
+	q.result = result
+}
+
+func (q *queryMatcher) canMerge(matcher) bool {
+	return false
+}
+
+func (q *queryMatcher) merge(matcher) (matcher, error) {
+	return nil, errors.New("method not supported")
+}
+
+func (q *queryMatcher) match(req *http.Request, st *matchState) *match {
+	step := st.begin(TraceStep{Matcher: "query", Pattern: q.name})
+	var result *match
+	if _, ok := req.URL.Query()[q.name]; ok {
+		result = q.result
+	}
+	st.end(step, result)
+	return result
 }
 
 // Regular expression matcher, takes a regular expression and requestMapper
@@ -148,9 +469,16 @@ func (r *regexpMatcher) merge(matcher) (matcher, error) {
 	return nil, errors.New("method not supported")
 }
 
-func (r *regexpMatcher) match(req *http.Request) *match {
-	if r.expr.MatchString(r.mapper.mapRequest(req)) {
-		return r.result
+func (r *regexpMatcher) match(req *http.Request, st *matchState) *match {
+	input := r.mapper.mapRequest(req)
+	step := -1
+	if st.tracing() {
+		step = st.begin(TraceStep{Matcher: "regexp", Mapper: r.mapper.String(), Input: input, Pattern: r.expr.String()})
+	}
+	var result *match
+	if r.expr.MatchString(input) {
+		result = r.result
 	}
-	return nil
+	st.end(step, result)
+	return result
 }
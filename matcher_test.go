@@ -21,14 +21,14 @@ func TestHostnameCase(t *testing.T) {
 	matcher2, err = hostTrieMatcher("Example.Com")
 	require.NoError(t, err)
 
-	assert.NotNil(t, matcher1.match(req))
-	assert.NotNil(t, matcher2.match(req))
+	assert.NotNil(t, matcher1.match(req, nil))
+	assert.NotNil(t, matcher2.match(req, nil))
 
 	matcher1, err = hostRegexpMatcher(`.*example.com`)
 	require.NoError(t, err)
 	matcher2, err = hostRegexpMatcher(`.*Example.Com`)
 	require.NoError(t, err)
 
-	assert.NotNil(t, matcher1.match(req))
-	assert.NotNil(t, matcher2.match(req))
+	assert.NotNil(t, matcher1.match(req, nil))
+	assert.NotNil(t, matcher2.match(req, nil))
 }
@@ -0,0 +1,100 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// mountKey is the request context key of the mount the request is routed through
+type mountKey struct{}
+
+// mount is the request path as seen by the Mux the handler is mounted to
+type mount struct {
+	path, rawPath string
+	// prefix is the path prefix stripped by the mounts, including the enclosing ones
+	prefix string
+}
+
+// Mount adds the handler serving the requests under the path prefix, e.g. Mount("/admin", handler)
+// routes the requests matching Path("/admin/<path:rest>") to the handler. The prefix is stripped
+// from r.URL.Path and r.URL.RawPath before calling the handler, the original path is available via OriginalPath.
+// The root prefix / is rejected, as the handler would serve all the requests, use Handle instead.
+// The URLs built by the mounted Mux include the prefix, see URL.
+func (m *Mux) Mount(prefix string, handler http.Handler) error {
+	if !strings.HasPrefix(prefix, "/") {
+		return fmt.Errorf("mount prefix '%s' should start with /", prefix)
+	}
+	if strings.ContainsAny(prefix, "<>") {
+		return fmt.Errorf("mount prefix '%s' can't contain patterns", prefix)
+	}
+	if strings.ContainsAny(prefix, "[]") || strings.HasSuffix(prefix, "/?") {
+		return fmt.Errorf("mount prefix '%s' can't contain optional parts", prefix)
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return errors.New("mount prefix '/' is the root, use Handle to serve all the requests")
+	}
+
+	if sub, ok := handler.(*Mux); ok {
+		sub.mutex.Lock()
+		sub.mountedTo, sub.mountedPrefix = m, prefix
+		sub.mutex.Unlock()
+	}
+	return m.Handle(fmt.Sprintf("Path(%q)", prefix+"/<path:rest>"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the enclosing mounts have stripped their prefixes already
+		mt := mount{path: r.URL.Path, rawPath: r.URL.RawPath, prefix: prefix}
+		if o, ok := r.Context().Value(mountKey{}).(mount); ok {
+			mt = mount{path: o.path, rawPath: o.rawPath, prefix: o.prefix + prefix}
+		}
+		handler.ServeHTTP(w, stripPrefix(r.WithContext(context.WithValue(r.Context(), mountKey{}, mt)), prefix))
+	}))
+}
+
+// mountPath returns the path prefix of the Mux mounted to the other ones, including the enclosing mounts
+func (m *Mux) mountPath() string {
+	m.mutex.RLock()
+	parent, prefix := m.mountedTo, m.mountedPrefix
+	m.mutex.RUnlock()
+	if parent == nil {
+		return ""
+	}
+	return parent.mountPath() + prefix
+}
+
+// stripPrefix strips the prefix from the path of the request copy, like http.StripPrefix does,
+// the request URI is updated as well, as the router matches the paths with escape symbols against it
+func stripPrefix(r *http.Request, prefix string) *http.Request {
+	u := *r.URL
+	u.Path = strings.TrimPrefix(u.Path, prefix)
+	u.RawPath = strings.TrimPrefix(u.RawPath, prefix)
+	r.URL = &u
+	r.RequestURI = u.RequestURI()
+	return r
+}
+
+// OriginalPath returns the request path before the mounts stripped their prefixes, see Mux.Mount
+func OriginalPath(r *http.Request) string {
+	if mt, ok := r.Context().Value(mountKey{}).(mount); ok {
+		return mt.path
+	}
+	return r.URL.Path
+}
+
+// OriginalRawPath works like OriginalPath, but returns the original r.URL.RawPath
+func OriginalRawPath(r *http.Request) string {
+	if mt, ok := r.Context().Value(mountKey{}).(mount); ok {
+		return mt.rawPath
+	}
+	return r.URL.RawPath
+}
+
+// MountPrefix returns the path prefix stripped by the mounts the request is routed through, see Mux.Mount
+func MountPrefix(r *http.Request) string {
+	if mt, ok := r.Context().Value(mountKey{}).(mount); ok {
+		return mt.prefix
+	}
+	return ""
+}
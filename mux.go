@@ -4,15 +4,36 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
 )
 
 // Mux implements router compatible with http.Handler
 type Mux struct {
 	// NotFound sets handler for routes that are not found
 	notFound http.Handler
-	router   Router
-	aliases  []alias
+	// methodNotAllowed sets handler for routes that are found for other methods only
+	methodNotAllowed http.Handler
+	router           TypedRouter[http.Handler]
+	aliases          []alias
+
+	opts MuxOptions
+	// middleware wraps the handlers registered after it's added, see Use
+	middleware []func(http.Handler) http.Handler
+
+	mutex sync.RWMutex
+	// methods are the methods checked by the Method matchers of the handled expressions,
+	// they are tried to populate the Allow header
+	methods map[string]bool
+	// anyMethod is set once the routes check the methods with patterns, regexps or negation,
+	// so all the standard methods are tried as well
+	anyMethod bool
+	// names are the expressions of the named routes, see HandleNamed
+	names map[string]string
+	// mountedTo is the Mux this one is mounted to with the prefix, see Mount and URL
+	mountedTo     *Mux
+	mountedPrefix string
 }
 
 type alias struct {
@@ -20,11 +41,30 @@ type alias struct {
 	replace string
 }
 
+// MuxOptions sets the optional behaviour of Mux, everything is off by default
+type MuxOptions struct {
+	// AutoOptions answers the OPTIONS requests matching no route, but matching the routes of
+	// other methods, with 200 OK and the Allow header listing the methods
+	AutoOptions bool
+	// AutoHead routes the HEAD requests matching no route to the GET handlers,
+	// the response body written by the handler is discarded
+	AutoHead bool
+}
+
 // NewMux returns new Mux router
 func NewMux() *Mux {
+	return NewMuxWithOptions(MuxOptions{})
+}
+
+// NewMuxWithOptions returns new Mux router with the optional behaviour enabled
+func NewMuxWithOptions(opts MuxOptions) *Mux {
 	return &Mux{
-		router:   New(),
-		notFound: &notFound{},
+		router:           NewTyped[http.Handler](),
+		notFound:         &notFound{},
+		methodNotAllowed: &methodNotAllowed{},
+		opts:             opts,
+		methods:          make(map[string]bool),
+		names:            make(map[string]string),
 	}
 }
 
@@ -47,32 +87,65 @@ func (m *Mux) applyAliases(expr string) (string, bool) {
 // init to load many rules on first startup, thus reducing the time it takes to
 // create the initial mux.
 func (m *Mux) InitHandlers(handlers map[string]interface{}) error {
-	if len(m.aliases) == 0 {
-		return m.router.InitRoutes(handlers)
-	}
-
 	// Apply aliases to routes
-	modified := make(map[string]interface{}, len(handlers))
+	modified := make(map[string]http.Handler, len(handlers))
 	for k, v := range handlers {
+		h, ok := v.(http.Handler)
+		if !ok {
+			return fmt.Errorf("handler for expression '%s' is %T, expected http.Handler", k, v)
+		}
 		// If an alias matched, add the modified route to the handlers passed
 		if alias, ok := m.applyAliases(k); ok {
-			modified[alias] = v
+			modified[alias] = h
+		}
+		modified[k] = h
+	}
+	for k, h := range modified {
+		modified[k] = wrap(h, m.middleware)
+	}
+	if err := m.router.InitRoutes(modified); err != nil {
+		return err
+	}
+	for expr := range modified {
+		m.addMethods(expr)
+	}
+	// the routes are replaced, so are the named ones
+	m.mutex.Lock()
+	for name, expr := range m.names {
+		if _, ok := modified[expr]; !ok {
+			delete(m.names, name)
 		}
-		modified[k] = v
 	}
-	return m.router.InitRoutes(modified)
+	m.mutex.Unlock()
+	return nil
+}
+
+// Use adds the middleware wrapping the handlers of the Mux, the middleware is applied once
+// when the handler is registered, so it wraps the handlers registered after the call only.
+// The first middleware added is the outermost one.
+func (m *Mux) Use(mw ...func(http.Handler) http.Handler) {
+	m.middleware = append(m.middleware, mw...)
 }
 
 // Handle adds http handler for route expression
 func (m *Mux) Handle(expr string, handler http.Handler) error {
+	return m.HandleWith(expr, handler)
+}
+
+// HandleWith adds http handler wrapped with the middleware for route expression,
+// the route middleware goes after the middleware of the Mux, see Use
+func (m *Mux) HandleWith(expr string, handler http.Handler, mw ...func(http.Handler) http.Handler) error {
+	handler = wrap(wrap(handler, mw), m.middleware)
 	if err := m.router.UpsertRoute(expr, handler); err != nil {
 		return err
 	}
+	m.addMethods(expr)
 
 	if alias, ok := m.applyAliases(expr); ok {
 		if err := m.router.UpsertRoute(alias, handler); err != nil {
 			return fmt.Errorf("while adding alias handler: %s", err)
 		}
+		m.addMethods(alias)
 	}
 	return nil
 }
@@ -86,6 +159,13 @@ func (m *Mux) Remove(expr string) error {
 	if err := m.router.RemoveRoute(expr); err != nil {
 		return err
 	}
+	m.mutex.Lock()
+	for name, e := range m.names {
+		if e == expr {
+			delete(m.names, name)
+		}
+	}
+	m.mutex.Unlock()
 
 	if alias, ok := m.applyAliases(expr); ok {
 		if err := m.router.RemoveRoute(alias); err != nil {
@@ -95,14 +175,54 @@ func (m *Mux) Remove(expr string) error {
 	return nil
 }
 
-// ServeHTTP routes the request and passes it to handler
+// Routes returns the routes in the order they are matched in, see Router.Routes
+func (m *Mux) Routes() []RouteInfo {
+	routes := m.router.Routes()
+	out := make([]RouteInfo, len(routes))
+	for i, r := range routes {
+		out[i] = RouteInfo{Expr: r.Expr, Value: r.Value, Alternative: r.Alternative, Priority: r.Priority, Merged: r.Merged}
+	}
+	return out
+}
+
+// Range calls the function for every route expression with its handler in the order they are matched in,
+// until the function returns false
+func (m *Mux) Range(fn func(expr string, val interface{}) bool) {
+	m.router.Range(func(expr string, h http.Handler) bool {
+		return fn(expr, h)
+	})
+}
+
+// ServeHTTP routes the request and passes it to handler,
+// values captured by the named trie patterns are available to the handler via r.PathValue,
+// the values captured from the path are unescaped, e.g. j%C3%B6rg is jörg, like http.ServeMux does.
+// If no route matches the request, but some routes match it with other methods,
+// the request is passed to the method not allowed handler with the Allow header set.
 func (m *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	h, err := m.router.Route(r)
-	if err != nil || h == nil {
-		m.notFound.ServeHTTP(w, r)
+	l := m.route(r, r.Method)
+	if l == nil && m.opts.AutoHead && r.Method == http.MethodHead {
+		if l = m.route(r, http.MethodGet); l != nil {
+			w = &headWriter{ResponseWriter: w}
+		}
+	}
+	if l == nil {
+		allow := m.allowed(r)
+		switch {
+		case len(allow) == 0:
+			m.notFound.ServeHTTP(w, r)
+		case m.opts.AutoOptions && r.Method == http.MethodOptions:
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+			m.methodNotAllowed.ServeHTTP(w, r)
+		}
 		return
 	}
-	h.(http.Handler).ServeHTTP(w, r)
+	for k, p := range l.Params {
+		r.SetPathValue(p.Name, l.pathValue(k))
+	}
+	l.Value.ServeHTTP(w, r)
 }
 
 func (m *Mux) SetNotFound(n http.Handler) error {
@@ -117,6 +237,144 @@ func (m *Mux) GetNotFound() http.Handler {
 	return m.notFound
 }
 
+func (m *Mux) SetMethodNotAllowed(n http.Handler) error {
+	if n == nil {
+		return errors.New("method not allowed handler cannot be nil: operation rejected")
+	}
+	m.methodNotAllowed = n
+	return nil
+}
+
+func (m *Mux) GetMethodNotAllowed() http.Handler {
+	return m.methodNotAllowed
+}
+
+// standardMethods are the methods tried for every request that matches no route
+var standardMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+// wrap returns the handler wrapped with the middleware, the first middleware is the outermost one
+func wrap(h http.Handler, mw []func(http.Handler) http.Handler) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// route returns the route matching the request with the method, or nil
+func (m *Mux) route(r *http.Request, method string) *TypedMatch[http.Handler] {
+	if r.Method != method {
+		req := *r
+		req.Method = method
+		r = &req
+	}
+	l, err := m.router.RouteWithParams(r)
+	if err != nil || l == nil || l.Value == nil {
+		return nil
+	}
+	return l
+}
+
+// allowed returns the methods other than the request method the request would be routed with,
+// the standard methods go first followed by the other methods of the Method matchers in alphabetical order.
+// The methods answered by the Mux itself are allowed as well once any other method is allowed.
+func (m *Mux) allowed(r *http.Request) []string {
+	methods := m.probeMethods()
+	allowed := make(map[string]bool)
+	for _, method := range methods {
+		if method != r.Method && m.route(r, method) != nil {
+			allowed[method] = true
+		}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	if m.opts.AutoHead && allowed[http.MethodGet] {
+		allowed[http.MethodHead] = true
+	}
+	if m.opts.AutoOptions {
+		allowed[http.MethodOptions] = true
+	}
+
+	var out []string
+	for _, method := range standardMethods {
+		if allowed[method] {
+			out = append(out, method)
+		}
+	}
+	for _, method := range methods {
+		if allowed[method] && !isStandardMethod(method) {
+			out = append(out, method)
+		}
+	}
+	return out
+}
+
+// probeMethods returns the methods the request matching no route is routed with to find the allowed ones,
+// the routes not checking the method would have matched the request already, so only the methods
+// checked by the routes are tried, and none if the routes do not check the method at all
+func (m *Mux) probeMethods() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var out, other []string
+	for _, method := range standardMethods {
+		if m.anyMethod || m.methods[method] {
+			out = append(out, method)
+		}
+	}
+	for method := range m.methods {
+		if !isStandardMethod(method) {
+			other = append(other, method)
+		}
+	}
+	sort.Strings(other)
+	return append(out, other...)
+}
+
+// addMethods remembers the methods checked by the Method matchers of the expression,
+// the methods are never forgotten, as trying the extra method is harmless
+func (m *Mux) addMethods(expr string) {
+	clauses, err := parseClauses(expr)
+	if err != nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.addClauseMethods(clauses, false)
+}
+
+func (m *Mux) addClauseMethods(clauses []clause, negated bool) {
+	for _, c := range clauses {
+		for _, cond := range c {
+			if cond.kind == "not" {
+				m.addClauseMethods(cond.negated, true)
+				continue
+			}
+			if _, ok := cond.mapper.(*methodMapper); !ok {
+				continue
+			}
+			// the patterns, regexps and negated methods match many methods, so all the standard ones are tried
+			if negated || cond.kind != "trie" || strings.ContainsRune(cond.value, '<') {
+				m.anyMethod = true
+				continue
+			}
+			m.methods[cond.value] = true
+		}
+	}
+}
+
+func isStandardMethod(method string) bool {
+	for _, s := range standardMethods {
+		if s == method {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *Mux) IsValid(expr string) bool {
 	return IsValid(expr)
 }
@@ -130,3 +388,27 @@ func (notFound) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusNotFound)
 	_, _ = fmt.Fprint(w, http.StatusText(http.StatusNotFound))
 }
+
+// headWriter discards the response body written by the GET handler serving the HEAD request
+type headWriter struct {
+	http.ResponseWriter
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// Unwrap returns the original writer, see http.ResponseController
+func (w *headWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// methodNotAllowed is a generic http.Handler for requests with not allowed methods
+type methodNotAllowed struct{}
+
+// ServeHTTP returns a simple 405 Method not allowed response
+func (methodNotAllowed) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	_, _ = fmt.Fprint(w, http.StatusText(http.StatusMethodNotAllowed))
+}
@@ -2,6 +2,7 @@ package route
 
 import (
 	"bytes"
+	"fmt"
 	"net/http"
 	"testing"
 
@@ -42,6 +43,42 @@ func (s *MuxSuite) TestRouting() {
 	s.Equal("/p", w.buf.String())
 }
 
+func (s *MuxSuite) TestPathValues() {
+	r := NewMux()
+
+	err := r.HandleFunc(`Host("<tenant>.example.com") && Path("/users/<int:id>") && Header("Accept", "application/<format>")`, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(req.PathValue("tenant") + " " + req.PathValue("id") + " " + req.PathValue("format")))
+	})
+	s.Require().NoError(err)
+
+	w := newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/users/42", host: "acme.example.com", headers: http.Header{"Accept": []string{"application/json"}}}))
+
+	s.Equal(http.StatusOK, w.header)
+	s.Equal("acme 42 json", w.buf.String())
+
+	w = newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/users/bob", host: "acme.example.com", headers: http.Header{"Accept": []string{"application/json"}}}))
+	s.Equal(http.StatusNotFound, w.header)
+
+	// the path captures are unescaped like http.ServeMux does, the other captures are kept as is
+	err = r.HandleFunc(`Path("/people/<name>/<path:rest>") && Header("X-Tag", "<tag>")`, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(req.PathValue("name") + " " + req.PathValue("rest") + " " + req.PathValue("tag")))
+	})
+	s.Require().NoError(err)
+
+	w = newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/people/j%C3%B6rg/a%2Fb/c", headers: http.Header{"X-Tag": []string{"100%25"}}}))
+	s.Equal(http.StatusOK, w.header)
+	s.Equal("jörg a/b/c 100%25", w.buf.String())
+
+	m, err := r.router.RouteWithParams(makeReq(req{url: "/people/j%C3%B6rg/a", headers: http.Header{"X-Tag": []string{"t"}}}))
+	s.Require().NoError(err)
+	s.Equal(Params{{Name: "name", Value: "j%C3%B6rg"}, {Name: "rest", Value: "a"}, {Name: "tag", Value: "t"}}, m.Params)
+}
+
 func (s *MuxSuite) TestInitHandlers() {
 	r := NewMux()
 
@@ -72,6 +109,17 @@ func (s *MuxSuite) TestInitHandlers() {
 	s.Equal("/f", w.buf.String())
 }
 
+func (s *MuxSuite) TestInitHandlersRejectsNonHandlers() {
+	r := NewMux()
+
+	err := r.InitHandlers(map[string]interface{}{`Path("/p")`: "not a handler"})
+	s.Require().Error(err)
+
+	w := newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/p"}))
+	s.Equal(http.StatusNotFound, w.header)
+}
+
 func (s *MuxSuite) TestAddAlias() {
 	expr := `Host("localhost") && Path("/p")`
 	f := func(w http.ResponseWriter, req *http.Request) {
@@ -152,12 +200,395 @@ func (s *MuxSuite) TestAddAliasOrder() {
 	s.Equal(http.StatusCreated, w.header)
 }
 
+func (s *MuxSuite) TestMethodNotAllowed() {
+	r := NewMux()
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	s.Require().NoError(r.Handle(`Method("GET") && Path("/users/<int:id>")`, h))
+	s.Require().NoError(r.Handle(`(Method("PUT") || Method("PURGE")) && Path("/users/<int:id>")`, h))
+	s.Require().NoError(r.Handle(`MethodRegexp("^(POST|DELETE)$") && Path("/users")`, h))
+
+	w := newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/users/1", method: "POST"}))
+	s.Equal(http.StatusMethodNotAllowed, w.header)
+	s.Equal("GET, PUT, PURGE", w.headers.Get("Allow"))
+	s.Equal(http.StatusText(http.StatusMethodNotAllowed), w.buf.String())
+
+	w = newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/users", method: "GET"}))
+	s.Equal(http.StatusMethodNotAllowed, w.header)
+	s.Equal("POST, DELETE", w.headers.Get("Allow"))
+
+	// the path does not match with any method
+	w = newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/users/bob", method: "GET"}))
+	s.Equal(http.StatusNotFound, w.header)
+	s.Empty(w.headers.Get("Allow"))
+
+	s.Error(r.SetMethodNotAllowed(nil))
+	s.Require().NoError(r.SetMethodNotAllowed(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte(w.Header().Get("Allow")))
+	})))
+	w = newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/users/1", method: "DELETE"}))
+	s.Equal(http.StatusTeapot, w.header)
+	s.Equal("GET, PUT, PURGE", w.buf.String())
+}
+
+func (s *MuxSuite) TestProbeMethods() {
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+
+	// the routes not checking the method are not retried with other methods
+	r := NewMux()
+	s.Require().NoError(r.Handle(`Path("/a")`, h))
+	s.Empty(r.probeMethods())
+	w := newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/b"}))
+	s.Equal(http.StatusNotFound, w.header)
+
+	s.Require().NoError(r.Handle(`Method("PURGE") && Path("/b")`, h))
+	s.Require().NoError(r.Handle(`(Method("POST") || Method("GET")) && Path("/c")`, h))
+	s.Equal([]string{"GET", "POST", "PURGE"}, r.probeMethods())
+
+	s.Require().NoError(r.Handle(`!Method("DELETE") && Path("/d")`, h))
+	s.Equal(append(append([]string(nil), standardMethods...), "PURGE"), r.probeMethods())
+	w = newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/d", method: "DELETE"}))
+	s.Equal(http.StatusMethodNotAllowed, w.header)
+	s.Equal("GET, HEAD, POST, PUT, PATCH, CONNECT, OPTIONS, TRACE, PURGE", w.headers.Get("Allow"))
+}
+
+func (s *MuxSuite) TestAutoOptionsAndHead() {
+	get := func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Method", req.Method)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("users " + req.PathValue("id")))
+	}
+	handle := func(r *Mux) {
+		s.Require().NoError(r.HandleFunc(`Method("GET") && Path("/users/<int:id>")`, get))
+		s.Require().NoError(r.HandleFunc(`Method("DELETE") && Path("/users/<int:id>")`, get))
+		s.Require().NoError(r.HandleFunc(`Method("HEAD") && Path("/explicit")`, func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		s.Require().NoError(r.HandleFunc(`Method("GET") && Path("/explicit")`, get))
+	}
+
+	// the behaviour is opt-in
+	r := NewMux()
+	handle(r)
+	w := newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/users/1", method: "HEAD"}))
+	s.Equal(http.StatusMethodNotAllowed, w.header)
+	s.Equal("GET, DELETE", w.headers.Get("Allow"))
+	w = newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/users/1", method: "OPTIONS"}))
+	s.Equal(http.StatusMethodNotAllowed, w.header)
+
+	r = NewMuxWithOptions(MuxOptions{AutoOptions: true, AutoHead: true})
+	handle(r)
+
+	w = newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/users/1", method: "HEAD"}))
+	s.Equal(http.StatusOK, w.header)
+	s.Equal("HEAD", w.headers.Get("X-Method"))
+	s.Empty(w.buf.String())
+
+	w = newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/explicit", method: "HEAD"}))
+	s.Equal(http.StatusNoContent, w.header)
+
+	w = newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/users/1", method: "OPTIONS"}))
+	s.Equal(http.StatusOK, w.header)
+	s.Equal("GET, HEAD, DELETE, OPTIONS", w.headers.Get("Allow"))
+	s.Empty(w.buf.String())
+
+	w = newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/users/1", method: "POST"}))
+	s.Equal(http.StatusMethodNotAllowed, w.header)
+	s.Equal("GET, HEAD, DELETE, OPTIONS", w.headers.Get("Allow"))
+
+	w = newWriter()
+	r.ServeHTTP(w, makeReq(req{url: "/other", method: "OPTIONS"}))
+	s.Equal(http.StatusNotFound, w.header)
+}
+
+func (s *MuxSuite) TestMiddleware() {
+	var calls []string
+	mw := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			calls = append(calls, "wrap "+name)
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, req)
+			})
+		}
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls = append(calls, "handler")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	r := NewMux()
+	s.Require().NoError(r.Handle(`Path("/before")`, h))
+	r.Use(mw("log"), mw("auth"))
+	s.Require().NoError(r.HandleWith(`Path("/a")`, h, mw("trace")))
+	s.Equal([]string{"wrap trace", "wrap auth", "wrap log"}, calls)
+
+	tc := []struct {
+		url   string
+		calls []string
+	}{
+		{url: "/before", calls: []string{"handler"}},
+		{url: "/a", calls: []string{"log", "auth", "trace", "handler"}},
+		{url: "/a", calls: []string{"log", "auth", "trace", "handler"}},
+	}
+	for _, t := range tc {
+		calls = nil
+		w := newWriter()
+		r.ServeHTTP(w, makeReq(req{url: t.url}))
+		s.Equal(http.StatusOK, w.header)
+		s.Equal(t.calls, calls, t.url)
+	}
+
+	r = NewMux()
+	r.Use(mw("log"))
+	s.Require().NoError(r.InitHandlers(map[string]interface{}{`Path("/b")`: h}))
+	calls = nil
+	r.ServeHTTP(newWriter(), makeReq(req{url: "/b"}))
+	s.Equal([]string{"log", "handler"}, calls)
+}
+
+func (s *MuxSuite) TestGroup() {
+	var calls []string
+	mw := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, req)
+			})
+		}
+	}
+	h := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(name + req.PathValue("id")))
+		}
+	}
+
+	r := NewMux()
+	api := r.Group(`Host("api.example.com") || Host("api.example.org")`)
+	api.Use(mw("api"))
+	s.Require().NoError(api.Handle(`Path("/users")`, h("users")))
+
+	v1 := api.Group(`PathRegexp("^/v1/")`)
+	v1.Use(mw("v1"))
+	s.Require().NoError(v1.Handle(`Path("/v1/users/<int:id>") || Path("/v1/people/<int:id>")`, h("user")))
+	s.Require().NoError(r.Handle(`Path("/health")`, h("health")))
+	// the middleware added to the parent group later wraps the nested group handlers registered after it
+	api.Use(mw("auth"))
+	s.Require().NoError(v1.Handle(`Path("/v1/admin")`, h("admin")))
+
+	var exprs []string
+	for _, route := range r.Routes() {
+		exprs = append(exprs, route.Expr)
+	}
+	s.ElementsMatch([]string{
+		`Path("/health")`,
+		`(Host("api.example.com") || Host("api.example.org")) && Path("/users")`,
+		`(Host("api.example.com") || Host("api.example.org")) && PathRegexp("^/v1/") && (Path("/v1/users/<int:id>") || Path("/v1/people/<int:id>"))`,
+		`(Host("api.example.com") || Host("api.example.org")) && PathRegexp("^/v1/") && Path("/v1/admin")`,
+	}, compact(exprs))
+
+	tc := []struct {
+		url, host string
+		status    int
+		body      string
+		calls     []string
+	}{
+		{url: "/users", host: "api.example.org", status: http.StatusOK, body: "users", calls: []string{"api"}},
+		{url: "/users", host: "example.com", status: http.StatusNotFound},
+		{url: "/v1/people/7", host: "api.example.com", status: http.StatusOK, body: "user7", calls: []string{"api", "v1"}},
+		{url: "/v1/admin", host: "api.example.com", status: http.StatusOK, body: "admin", calls: []string{"api", "auth", "v1"}},
+		{url: "/health", host: "api.example.com", status: http.StatusOK, body: "health"},
+	}
+	for _, t := range tc {
+		calls = nil
+		w := newWriter()
+		r.ServeHTTP(w, makeReq(req{url: t.url, host: t.host}))
+		s.Equal(t.status, w.header, t.url)
+		if t.status == http.StatusOK {
+			s.Equal(t.body, w.buf.String(), t.url)
+		}
+		s.Equal(t.calls, calls, t.url)
+	}
+
+	s.Require().NoError(r.RemoveGroup(api))
+	s.Equal([]string{`Path("/health")`}, compact(nil, r.Routes()...))
+}
+
+func (s *MuxSuite) TestMount() {
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintf(w, "%s %s %s %s %s", req.URL.Path, req.URL.RawPath, OriginalPath(req), OriginalRawPath(req), MountPrefix(req))
+	})
+
+	admin := NewMux()
+	s.Require().NoError(admin.Handle(`Path("/users")`, h))
+	s.Require().NoError(admin.Mount("/debug/", h))
+
+	r := NewMux()
+	s.Require().NoError(r.Mount("/admin", admin))
+	s.Require().NoError(r.Handle(`Path("/")`, h))
+	s.Equal(`Path("/admin/<path:rest>")`, r.Routes()[0].Expr)
+
+	s.EqualError(r.Mount("admin", h), "mount prefix 'admin' should start with /")
+	s.EqualError(r.Mount("/", h), "mount prefix '/' is the root, use Handle to serve all the requests")
+	s.Error(r.Mount("/<tenant>", h))
+	s.Error(r.Mount("/v[1]", h))
+	s.Error(r.Mount("/v1]", h))
+	s.Error(r.Mount("/v1/?", h))
+
+	tc := []struct {
+		url    string
+		status int
+		body   string
+	}{
+		{url: "/", status: http.StatusOK, body: "/  /  "},
+		{url: "/admin/users", status: http.StatusOK, body: "/users  /admin/users  /admin"},
+		{url: "/admin/debug/", status: http.StatusOK, body: "/  /admin/debug/  /admin/debug"},
+		{url: "/admin/debug/a%2Fb", status: http.StatusOK, body: "/a/b /a%2Fb /admin/debug/a/b /admin/debug/a%2Fb /admin/debug"},
+		{url: "/admin", status: http.StatusNotFound},
+		{url: "/administrator/users", status: http.StatusNotFound},
+		{url: "/admin/other", status: http.StatusNotFound},
+	}
+	for _, t := range tc {
+		w := newWriter()
+		r.ServeHTTP(w, makeReq(req{url: t.url}))
+		s.Equal(t.status, w.header, t.url)
+		if t.status == http.StatusOK {
+			s.Equal(t.body, w.buf.String(), t.url)
+		}
+	}
+
+	// the URLs built by the mounted Mux include the prefixes of the enclosing mounts
+	tools := NewMux()
+	s.Require().NoError(tools.HandleNamed("tool", `Path("/tools/<name>")`, h))
+	s.Require().NoError(admin.Mount("/ops", tools))
+	s.Require().NoError(admin.HandleNamed("user", `Path("/users/<int:id>")`, h))
+	u, err := admin.URL("user", map[string]string{"id": "1"})
+	s.Require().NoError(err)
+	s.Equal("/admin/users/1", u.String())
+	u, err = tools.URL("tool", map[string]string{"name": "gc"})
+	s.Require().NoError(err)
+	s.Equal("/admin/ops/tools/gc", u.String())
+
+	w := newWriter()
+	r.ServeHTTP(w, makeReq(req{url: u.String()}))
+	s.Equal(http.StatusOK, w.header)
+	s.Equal("/tools/gc  /admin/ops/tools/gc  /admin/ops", w.buf.String())
+}
+
+func (s *MuxSuite) TestURL() {
+	r := NewMux()
+	h := http.NotFoundHandler()
+	s.Require().NoError(r.HandleNamed("user", `Host("<tenant>.example.com") && Path("/users/<int:id>") && Method("GET")`, h))
+	s.Require().NoError(r.HandleNamed("files", `Path("/files/<path:file>") && Query("v", "<int:v>")`, h))
+	s.Require().NoError(r.HandleNamed("search", `PathRegexp("^/search") || Path("/find/<q>")`, h))
+	s.Require().NoError(r.HandleNamed("regexp", `PathRegexp("^/search")`, h))
+	s.Require().NoError(r.HandleNamed("any", `Host("example.com")`, h))
+	s.Require().NoError(r.HandleNamed("items", `Path("/items[/<int:id>]")`, h))
+	s.Require().NoError(r.HandleNamed("accept", `Path("/users/<int:id>") && Header("Accept", "application/<sub>")`, h))
+	s.EqualError(r.HandleNamed("user", `Path("/other")`, h), `route name 'user' is used by expression 'Host("<tenant>.example.com") && Path("/users/<int:id>") && Method("GET")'`)
+
+	tc := []struct {
+		name   string
+		params map[string]string
+		url    string
+		err    string
+	}{
+		{name: "user", params: map[string]string{"tenant": "acme", "id": "42"}, url: "//acme.example.com/users/42"},
+		{name: "user", params: map[string]string{"tenant": "acme", "id": "bob"}, err: `route 'user' can't be reversed: Path("/users/<int:id>"): parameter 'id' value 'bob' does not match <int:id>`},
+		{name: "user", params: map[string]string{"tenant": "a.b", "id": "1"}, err: `route 'user' can't be reversed: Host("<tenant>.example.com"): parameter 'tenant' value 'a.b' does not match <string:tenant>`},
+		{name: "user", params: map[string]string{"id": "1"}, err: `route 'user' can't be reversed: Host("<tenant>.example.com"): missing parameter 'tenant'`},
+		{name: "files", params: map[string]string{"file": "a/b c.txt", "v": "2"}, url: "/files/a/b%20c.txt?v=2"},
+		{name: "search", params: map[string]string{"q": "cats"}, url: "/find/cats"},
+		{name: "regexp", err: `route 'regexp' can't be reversed: the path is checked by PathRegexp("^/search") only`},
+		{name: "any", err: `route 'any' can't be reversed: no Path matcher`},
+		{name: "items", params: map[string]string{"id": "7"}, url: "/items/7"},
+		{name: "items", url: "/items"},
+		{name: "accept", params: map[string]string{"id": "1"}, url: "/users/1"},
+		{name: "missing", err: `route 'missing' not found`},
+	}
+	for _, t := range tc {
+		u, err := r.URL(t.name, t.params)
+		if t.err != "" {
+			s.EqualError(err, t.err, t.name)
+			continue
+		}
+		s.Require().NoError(err, t.name)
+		s.Equal(t.url, u.String(), t.name)
+	}
+
+	// the built URL is routed to the named route
+	u, err := r.URL("user", map[string]string{"tenant": "acme", "id": "42"})
+	s.Require().NoError(err)
+	m, err := r.router.RouteWithParams(makeReq(req{url: u.Path, host: u.Host, method: "GET"}))
+	s.Require().NoError(err)
+	s.Require().NotNil(m)
+	s.Equal(`Host("<tenant>.example.com") && Path("/users/<int:id>") && Method("GET")`, m.Expr)
+
+	s.Require().NoError(r.Remove(`PathRegexp("^/search")`))
+	_, err = r.URL("regexp", nil)
+	s.EqualError(err, `route 'regexp' not found`)
+}
+
+// compact returns the unique route expressions
+func compact(exprs []string, routes ...RouteInfo) []string {
+	for _, r := range routes {
+		exprs = append(exprs, r.Expr)
+	}
+	var out []string
+	seen := make(map[string]bool)
+	for _, e := range exprs {
+		if !seen[e] {
+			seen[e] = true
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
 type testWriter struct {
 	header  int
 	buf     *bytes.Buffer
 	headers http.Header
 }
 
+func (s *MuxSuite) TestRoutes() {
+	r := NewMux()
+	r.AddAlias(`Host("localhost")`, `Host("example.com")`)
+	h := http.NotFoundHandler()
+	s.Require().NoError(r.Handle(`Host("localhost") && Path("/a")`, h))
+
+	routes := r.Routes()
+	s.Require().Len(routes, 2)
+	s.Equal(`Host("localhost") && Path("/a")`, routes[0].Expr)
+	s.Equal(`Host("example.com") && Path("/a")`, routes[1].Expr)
+	s.True(routes[0].Merged)
+	s.NotNil(routes[0].Value)
+
+	var exprs []string
+	r.Range(func(expr string, val interface{}) bool {
+		s.NotNil(val)
+		exprs = append(exprs, expr)
+		return true
+	})
+	s.Equal([]string{`Host("localhost") && Path("/a")`, `Host("example.com") && Path("/a")`}, exprs)
+}
+
 func newWriter() *testWriter {
 	return &testWriter{
 		buf:     &bytes.Buffer{},
@@ -2,10 +2,14 @@ package route
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/vulcand/predicate"
 )
 
+// maxExpansions limits the amount of patterns the optional parts of the path pattern expand into
+const maxExpansions = 64
+
 // IsValid checks whether expression is valid
 func IsValid(expr string) bool {
 	_, err := parse(expr, &match{})
@@ -13,8 +17,32 @@ func IsValid(expr string) bool {
 }
 
 func parse(expression string, result *match) (matcher, error) {
+	// Priority is a property of the whole route, so it is collected here
+	// instead of being matched against the request
+	var priority *int
+	// prioritized is the matcher combined with Priority using && operator,
+	// it can only be combined further with && to keep Priority at the top level
+	var prioritized matcher
+	hasPriority := func(ms ...matcher) bool {
+		for _, m := range ms {
+			if _, ok := m.(*priorityMatcher); ok || (prioritized != nil && m == prioritized) {
+				return true
+			}
+		}
+		return false
+	}
+	errPriority := fmt.Errorf("priority should be combined with other matchers using && operator at the top level")
+
 	p, err := predicate.NewParser(predicate.Def{
 		Functions: map[string]interface{}{
+			"Priority": func(value int) (matcher, error) {
+				if priority != nil {
+					return nil, fmt.Errorf("priority is defined more than once")
+				}
+				priority = &value
+				return &priorityMatcher{}, nil
+			},
+
 			"Host":       hostTrieMatcher,
 			"HostRegexp": hostRegexpMatcher,
 
@@ -26,9 +54,31 @@ func parse(expression string, result *match) (matcher, error) {
 
 			"Header":       headerTrieMatcher,
 			"HeaderRegexp": headerRegexpMatcher,
+
+			"Query":       queryTrieMatcher,
+			"QueryRegexp": queryRegexpMatcher,
+			"QueryExists": queryExistsMatcher,
 		},
 		Operators: predicate.Operators{
-			AND: newAndMatcher,
+			AND: func(a, b matcher) matcher {
+				if !hasPriority(a, b) {
+					return newAndMatcher(a, b)
+				}
+				prioritized = newAndMatcher(a, b)
+				return prioritized
+			},
+			OR: func(a, b matcher) (matcher, error) {
+				if hasPriority(a, b) {
+					return nil, errPriority
+				}
+				return newOrMatcher(a, b), nil
+			},
+			NOT: func(m matcher) (matcher, error) {
+				if hasPriority(m) {
+					return nil, errPriority
+				}
+				return newNotMatcher(m), nil
+			},
 		},
 	})
 	if err != nil {
@@ -44,8 +94,88 @@ func parse(expression string, result *match) (matcher, error) {
 	if !ok {
 		return nil, fmt.Errorf("unknown result type: %T", out)
 	}
+	if _, ok := m.(*priorityMatcher); ok {
+		return nil, errPriority
+	}
 
 	m.setMatch(result)
-	
+	if priority != nil {
+		result.priority = *priority
+	}
+
 	return m, nil
 }
+
+// expandPattern expands the optional parts of the path pattern into the patterns with and without them,
+// the patterns with the optional parts go first, e.g. /items[/<int:id>] expands into /items/<int:id> and /items.
+// The /? at the end of the pattern is the optional trailing slash, e.g. /users/? expands into /users/ and /users.
+// The backslash escapes the literal [, ], ? and \ characters, e.g. /a\[1\] is /a[1].
+func expandPattern(pattern string) ([]string, error) {
+	out, _, err := expandGroup(pattern, 0, false)
+	if err != nil {
+		return nil, fmt.Errorf("pattern '%s': %w", pattern, err)
+	}
+	// the optional parts may expand into the same patterns, e.g. /a[/][/]
+	seen := make(map[string]bool, len(out))
+	unique := out[:0]
+	for _, p := range out {
+		if !seen[p] {
+			seen[p] = true
+			unique = append(unique, p)
+		}
+	}
+	return unique, nil
+}
+
+// expandGroup expands the pattern starting at the offset up to the end of the optional group if it's nested,
+// returns the expanded patterns and the offset after the group
+func expandGroup(pattern string, offset int, nested bool) ([]string, int, error) {
+	out := []string{""}
+	appendAll := func(parts []string) error {
+		var next []string
+		for _, p := range out {
+			for _, part := range parts {
+				next = append(next, p+part)
+			}
+		}
+		if len(next) > maxExpansions {
+			return fmt.Errorf("optional parts expand into more than %d patterns", maxExpansions)
+		}
+		out = next
+		return nil
+	}
+
+	for i := offset; i < len(pattern); {
+		var parts []string
+		switch c := pattern[i]; {
+		case c == '<' && reParam.MatchString(pattern[i:]):
+			// the placeholders are copied as is, e.g. the regexp of <re:name:[a-z]+>
+			end := i + reParam.FindStringIndex(pattern[i:])[1]
+			parts, i = []string{pattern[i:end]}, end
+		case c == '\\' && i+1 < len(pattern) && strings.IndexByte(`[]?\`, pattern[i+1]) != -1:
+			parts, i = []string{pattern[i+1 : i+2]}, i+2
+		case c == '[':
+			group, end, err := expandGroup(pattern, i+1, true)
+			if err != nil {
+				return nil, 0, err
+			}
+			parts, i = append(group, ""), end
+		case c == ']':
+			if !nested {
+				return nil, 0, fmt.Errorf("unexpected ] at %d", i)
+			}
+			return out, i + 1, nil
+		case c == '/' && i == len(pattern)-2 && pattern[i+1] == '?' && !nested:
+			parts, i = []string{"/", ""}, i+2
+		default:
+			parts, i = []string{string(c)}, i+1
+		}
+		if err := appendAll(parts); err != nil {
+			return nil, 0, err
+		}
+	}
+	if nested {
+		return nil, 0, fmt.Errorf("missing ] of [ at %d", offset-1)
+	}
+	return out, len(pattern), nil
+}
@@ -119,6 +119,91 @@ func TestParseAndMatchSuccess(t *testing.T) {
 			Host:       "a.b.localhost",
 			Headers:    map[string][]string{"Content-Type": {"application/json"}},
 		},
+		// Query cases
+		{
+			Expression: `Path("/helloworld") && Query("version", "v<int:n>")`,
+			Url:        `http://google.com/helloworld?version=v2`,
+			Method:     http.MethodGet,
+			Host:       "localhost",
+		},
+		{
+			Expression: `Path("/helloworld") && QueryRegexp("debug", "^(1|true)$")`,
+			Url:        `http://google.com/helloworld?debug=true`,
+			Method:     http.MethodGet,
+			Host:       "localhost",
+		},
+		{
+			Expression: `Path("/helloworld") && QueryExists("debug")`,
+			Url:        `http://google.com/helloworld?debug`,
+			Method:     http.MethodGet,
+			Host:       "localhost",
+		},
+		// Alternatives
+		{
+			Expression: `Path("/hello") || Path("/helloworld")`,
+			Url:        `http://google.com/helloworld`,
+			Method:     http.MethodGet,
+			Host:       "localhost",
+		},
+		{
+			Expression: `Host("localhost") && (Method("POST") || Method("GET")) && Path("/helloworld")`,
+			Url:        `http://google.com/helloworld`,
+			Method:     http.MethodGet,
+			Host:       "localhost",
+		},
+		{
+			Expression: `(Host("example.com") || HostRegexp(".*host")) && Path("/helloworld")`,
+			Url:        `http://google.com/helloworld`,
+			Method:     http.MethodGet,
+			Host:       "localhost",
+		},
+		{
+			Expression: `Host("example.com") && Path("/helloworld") || Method("GET") && PathRegexp("/hello.*")`,
+			Url:        `http://google.com/helloworld`,
+			Method:     http.MethodGet,
+			Host:       "localhost",
+		},
+		// Negation
+		{
+			Expression: `Host("localhost") && !PathRegexp("^/internal/")`,
+			Url:        `http://google.com/helloworld`,
+			Method:     http.MethodGet,
+			Host:       "localhost",
+		},
+		{
+			Expression: `!(Method("POST") || Method("PUT")) && Path("/helloworld")`,
+			Url:        `http://google.com/helloworld`,
+			Method:     http.MethodGet,
+			Host:       "localhost",
+		},
+		{
+			Expression: `!!Path("/helloworld")`,
+			Url:        `http://google.com/helloworld`,
+			Method:     http.MethodGet,
+			Host:       "localhost",
+		},
+		{
+			Expression: `Host("localhost") && Path("/items[/<int:id>]")`,
+			Url:        `http://google.com/items`,
+			Method:     http.MethodGet,
+			Host:       "localhost",
+		},
+		{
+			Expression: `Host("localhost") && Path("/items[/<int:id>]")`,
+			Url:        `http://google.com/items/42`,
+			Method:     http.MethodGet,
+			Host:       "localhost",
+		},
+		{
+			Expression: `Path("/users/?")`,
+			Url:        `http://google.com/users/`,
+			Method:     http.MethodGet,
+		},
+		{
+			Expression: `Path("/users/?")`,
+			Url:        `http://google.com/users`,
+			Method:     http.MethodGet,
+		},
 		// Regexp cases
 		{
 			Expression: `PathRegexp("/helloworld")`,
@@ -152,13 +237,89 @@ func TestParseAndMatchSuccess(t *testing.T) {
 			req.Host = tc.Host
 			req.Header = tc.Headers
 
-			out := p.match(req)
+			out := p.match(req, nil)
 			assert.NotNil(t, p)
 			assert.Equal(t, result, out)
 		})
 	}
 }
 
+func TestParseNoMatch(t *testing.T) {
+	testCases := []struct {
+		Expression string
+		Url        string
+		Method     string
+		Host       string
+	}{
+		{
+			Expression: `Path("/hello") || Path("/world")`,
+			Url:        `http://google.com/helloworld`,
+			Method:     http.MethodGet,
+		},
+		{
+			Expression: `Host("localhost") && (Method("POST") || Method("PUT")) && Path("/helloworld")`,
+			Url:        `http://google.com/helloworld`,
+			Method:     http.MethodGet,
+			Host:       "localhost",
+		},
+		{
+			Expression: `Host("example.com") && Path("/helloworld") || Method("POST") && PathRegexp("/hello.*")`,
+			Url:        `http://google.com/helloworld`,
+			Method:     http.MethodGet,
+			Host:       "localhost",
+		},
+		{
+			Expression: `Path("/helloworld") && Query("version", "v<int:n>")`,
+			Url:        `http://google.com/helloworld?version=latest`,
+			Method:     http.MethodGet,
+		},
+		{
+			Expression: `Path("/helloworld") && QueryRegexp("debug", "^(1|true)$")`,
+			Url:        `http://google.com/helloworld?debug=0`,
+			Method:     http.MethodGet,
+		},
+		{
+			Expression: `Path("/helloworld") && QueryExists("debug")`,
+			Url:        `http://google.com/helloworld?verbose=1`,
+			Method:     http.MethodGet,
+		},
+		{
+			Expression: `Host("localhost") && !PathRegexp("^/internal/")`,
+			Url:        `http://google.com/internal/status`,
+			Method:     http.MethodGet,
+			Host:       "localhost",
+		},
+		{
+			Expression: `Path("/items[/<int:id>]")`,
+			Url:        `http://google.com/items/abc`,
+			Method:     http.MethodGet,
+		},
+		{
+			Expression: `!Path("/users/?")`,
+			Url:        `http://google.com/users`,
+			Method:     http.MethodGet,
+		},
+		{
+			Expression: `!(Method("POST") || Method("GET")) && Path("/helloworld")`,
+			Url:        `http://google.com/helloworld`,
+			Method:     http.MethodGet,
+			Host:       "localhost",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Expression, func(t *testing.T) {
+			p, err := parse(tc.Expression, &match{val: "ok"})
+			assert.NoError(t, err)
+
+			req := makeReq(req{url: tc.Url})
+			req.Method = tc.Method
+			req.Host = tc.Host
+
+			assert.Nil(t, p.match(req, nil))
+		})
+	}
+}
+
 func TestParseFailures(t *testing.T) {
 	testCases := []struct {
 		desc string
@@ -174,7 +335,7 @@ func TestParseFailures(t *testing.T) {
 		},
 		{
 			desc: "unsupported operator",
-			expr: `Path("/path") || Path("/path2")`,
+			expr: `Path("/path") == Path("/path2")`,
 		},
 		{
 			desc: "unsupported statements",
@@ -212,10 +373,42 @@ func TestParseFailures(t *testing.T) {
 			desc: "bad trie expression",
 			expr: `Path("")`,
 		},
+		{
+			desc: "priority defined twice",
+			expr: `Priority(1) && Path("/a") && Priority(2)`,
+		},
+		{
+			desc: "priority only",
+			expr: `Priority(10)`,
+		},
+		{
+			desc: "priority alternative",
+			expr: `Priority(1) || Path("/a")`,
+		},
+		{
+			desc: "nested priority",
+			expr: `(Priority(1) && Path("/a")) || Path("/b")`,
+		},
+		{
+			desc: "negated priority",
+			expr: `!Priority(1) && Path("/a")`,
+		},
+		{
+			desc: "bad priority argument type",
+			expr: `Priority("1") && Path("/a")`,
+		},
 		{
 			desc: "bad regular expression",
 			expr: `PathRegexp("[[[[")`,
 		},
+		{
+			desc: "unclosed optional group",
+			expr: `Path("/items[/<int:id>")`,
+		},
+		{
+			desc: "unopened optional group",
+			expr: `Path("/items/<int:id>]")`,
+		},
 	}
 
 	for _, test := range testCases {
@@ -229,3 +422,37 @@ func TestParseFailures(t *testing.T) {
 		})
 	}
 }
+
+func TestExpandPattern(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		expected []string
+	}{
+		{pattern: "/items", expected: []string{"/items"}},
+		{pattern: "/items[/<int:id>]", expected: []string{"/items/<int:id>", "/items"}},
+		{pattern: "/users/?", expected: []string{"/users/", "/users"}},
+		{pattern: "/a[/b[/c]]/?", expected: []string{"/a/b/c/", "/a/b/c", "/a/b/", "/a/b", "/a/", "/a"}},
+		{pattern: "/a[/][/]", expected: []string{"/a//", "/a/", "/a"}},
+		{pattern: "/files[/<re:name:[a-z]+>.txt]", expected: []string{"/files/<re:name:[a-z]+>.txt", "/files"}},
+		{pattern: "/a?b", expected: []string{"/a?b"}},
+		{pattern: "/a[/?]", expected: []string{"/a/?", "/a"}},
+		{pattern: `/a\[1\]`, expected: []string{"/a[1]"}},
+		{pattern: `/a[/\[b\]]`, expected: []string{"/a/[b]", "/a"}},
+		{pattern: `/a/\?`, expected: []string{"/a/?"}},
+		{pattern: `/a\\b`, expected: []string{`/a\b`}},
+		{pattern: `/a\b`, expected: []string{`/a\b`}},
+		{pattern: `/files/<re:name:[a-z\]]+>`, expected: []string{`/files/<re:name:[a-z\]]+>`}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			out, err := expandPattern(tc.pattern)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, out)
+		})
+	}
+
+	for _, p := range []string{"/a[", "/a]", "/a[/b]]", "[/a][/b][/c][/d][/e][/f][/g]"} {
+		_, err := expandPattern(p)
+		assert.Error(t, err, p)
+	}
+}
@@ -0,0 +1,127 @@
+package route
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// PatternMatcher matches the placeholder of the trie pattern, e.g. <tenantid:t> in Path("/<tenantid:t>/users"),
+// the matchers are created by the factories registered with RegisterPatternMatcher
+type PatternMatcher interface {
+	// Name returns the name of the parameter the matched characters are captured as
+	Name() string
+	// Match consumes the matching characters from the iterator and returns true if they match,
+	// the characters consumed by the failed match are pushed back by the router
+	Match(Iterator) bool
+	// Equals returns true if the matchers match the same characters and capture the same parameter,
+	// the trie nodes with equal matchers are merged
+	Equals(PatternMatcher) bool
+	// String returns the placeholder of the matcher, e.g. <tenantid:t>
+	String() string
+}
+
+// Iterator iterates over the characters of the request property matched by the trie,
+// e.g. the path or the host. The iterator stops at the end of the property, the rest of the combined
+// properties, e.g. the path of Host("...") && Path("..."), is not available to the pattern matchers.
+type Iterator interface {
+	// Next returns the next character and the separator of the property, e.g. / for the path
+	// or . for the host, ok is false once the property ends
+	Next() (c byte, sep byte, ok bool)
+	// PushBack returns the last character consumed back to the iterator
+	PushBack()
+}
+
+var patternMatchers = struct {
+	sync.RWMutex
+	factories map[string]func(args []string) (PatternMatcher, error)
+}{factories: make(map[string]func(args []string) (PatternMatcher, error))}
+
+// RegisterPatternMatcher registers the factory of the pattern matcher type, e.g. the factory registered
+// as tenantid is called with args [t] for <tenantid:t>. The placeholder with a single argument, e.g. <t>,
+// is always the string matcher. It panics if the name is not valid, is built-in, or is registered already.
+func RegisterPatternMatcher(name string, factory func(args []string) (PatternMatcher, error)) {
+	if name == "" || strings.ContainsAny(name, "<>:") {
+		panic(fmt.Sprintf("route: pattern matcher name '%s' is not valid", name))
+	}
+	if factory == nil {
+		panic(fmt.Sprintf("route: pattern matcher '%s' factory is nil", name))
+	}
+	if _, ok := builtinMatchers[name]; ok {
+		panic(fmt.Sprintf("route: pattern matcher '%s' is built-in", name))
+	}
+
+	patternMatchers.Lock()
+	defer patternMatchers.Unlock()
+	if _, ok := patternMatchers.factories[name]; ok {
+		panic(fmt.Sprintf("route: pattern matcher '%s' is registered already", name))
+	}
+	patternMatchers.factories[name] = factory
+}
+
+// makeRegisteredMatcher returns the matcher made by the registered factory
+func makeRegisteredMatcher(matcherType string, matcherArgs []string) (patternMatcher, error) {
+	patternMatchers.RLock()
+	factory, ok := patternMatchers.factories[matcherType]
+	patternMatchers.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported matcher: %s", matcherType)
+	}
+	m, err := factory(matcherArgs)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, fmt.Errorf("matcher %s factory returned nil", matcherType)
+	}
+	return &customMatcher{m: m}, nil
+}
+
+// customMatcher adapts the registered pattern matcher to the trie
+type customMatcher struct {
+	m PatternMatcher
+}
+
+func (c *customMatcher) String() string {
+	return c.m.String()
+}
+
+func (c *customMatcher) getName() string {
+	return c.m.Name()
+}
+
+func (c *customMatcher) match(i *charIter) bool {
+	p := i.position()
+	if !c.m.Match(&segmentIter{iter: i, start: p}) {
+		i.setPosition(p)
+		return false
+	}
+	return true
+}
+
+func (c *customMatcher) equals(other patternMatcher) bool {
+	o, ok := other.(*customMatcher)
+	return ok && c.m.Equals(o.m)
+}
+
+// segmentIter is the iterator over the current string of the sequence, see Iterator
+type segmentIter struct {
+	iter *charIter
+	// start is the position the matcher starts at, it can't push back further
+	start charPos
+}
+
+func (s *segmentIter) Next() (byte, byte, bool) {
+	// the iterator moves to the next string right after the last character of the current one
+	if s.iter.level() != s.start.si {
+		return 0, 0, false
+	}
+	return s.iter.next()
+}
+
+func (s *segmentIter) PushBack() {
+	if p := s.iter.position(); p.i == s.start.i && p.si == s.start.si {
+		return
+	}
+	s.iter.pushBack()
+}
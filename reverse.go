@@ -0,0 +1,142 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HandleNamed adds http handler for route expression like Handle does,
+// the name refers to the route when building its URL, see URL
+func (m *Mux) HandleNamed(name, expr string, handler http.Handler) error {
+	m.mutex.RLock()
+	prev, ok := m.names[name]
+	m.mutex.RUnlock()
+	if ok && prev != expr {
+		return fmt.Errorf("route name '%s' is used by expression '%s'", name, prev)
+	}
+
+	if err := m.Handle(expr, handler); err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	m.names[name] = expr
+	m.mutex.Unlock()
+	return nil
+}
+
+// URL builds the URL of the named route, filling the placeholders of the Host, Path and Query matchers
+// with the parameters, e.g. Host("<tenant>.example.com") && Path("/users/<int:id>") with tenant=acme and id=42
+// is //acme.example.com/users/42. The URL has no scheme, and has no host if the route does not check it.
+// The other matchers, e.g. Header or Method, are not the part of the URL and need no parameters.
+// The path of the Mux mounted to the other one starts with the mount prefix, see Mount.
+// The first alternative of the route that can be built is used. The routes matching the path
+// with regular expressions only can't be reversed.
+func (m *Mux) URL(name string, params map[string]string) (*url.URL, error) {
+	m.mutex.RLock()
+	expr, ok := m.names[name]
+	m.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("route '%s' not found", name)
+	}
+
+	clauses, err := parseClauses(expr)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, c := range clauses {
+		u, err := reverse(c, params)
+		if err == nil {
+			u.Path = m.mountPath() + u.Path
+			return u, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("route '%s' can't be reversed: %w", name, errors.Join(errs...))
+}
+
+// reverse builds the URL matching the conditions of the route alternative
+func reverse(c clause, params map[string]string) (*url.URL, error) {
+	u := &url.URL{}
+	var query url.Values
+	path, host := false, false
+	for _, cond := range c {
+		if cond.kind != "trie" {
+			continue
+		}
+		// the other properties, e.g. the headers, are not the part of the URL
+		switch cond.mapper.(type) {
+		case *pathMapper, *hostMapper, *queryMapper:
+		default:
+			continue
+		}
+		val, err := fill(cond.value, cond.mapper.separator(), params)
+		if err != nil {
+			return nil, fmt.Errorf("%s(%q): %w", cond.mapper, cond.value, err)
+		}
+		switch mp := cond.mapper.(type) {
+		case *pathMapper:
+			u.Path, path = val, true
+		case *hostMapper:
+			u.Host, host = val, true
+		case *queryMapper:
+			if query == nil {
+				query = url.Values{}
+			}
+			query.Add(mp.name, val)
+		}
+	}
+	for _, cond := range c {
+		if cond.kind != "regexp" {
+			continue
+		}
+		switch cond.mapper.(type) {
+		case *pathMapper:
+			if !path {
+				return nil, fmt.Errorf("the path is checked by PathRegexp(%q) only", cond.value)
+			}
+		case *hostMapper:
+			if !host {
+				return nil, fmt.Errorf("the host is checked by HostRegexp(%q) only", cond.value)
+			}
+		}
+	}
+	if !path {
+		return nil, errors.New("no Path matcher")
+	}
+	if query != nil {
+		u.RawQuery = query.Encode()
+	}
+	return u, nil
+}
+
+// fill replaces the placeholders of the trie pattern with the parameters,
+// the parameters have to match the placeholders, e.g. <int:id> takes digits only
+func fill(pattern string, sep byte, params map[string]string) (string, error) {
+	b := &strings.Builder{}
+	for i := 0; i < len(pattern); {
+		pm, next, err := parsePatternMatcher(i, pattern)
+		if err != nil {
+			return "", err
+		}
+		if pm == nil {
+			b.WriteByte(pattern[i])
+			i++
+			continue
+		}
+		val, ok := params[pm.getName()]
+		if !ok {
+			return "", fmt.Errorf("missing parameter '%s'", pm.getName())
+		}
+		it := newIter([]string{val}, []byte{sep})
+		if !pm.match(it) || !it.isEnd() {
+			return "", fmt.Errorf("parameter '%s' value '%s' does not match %s", pm.getName(), val, pm)
+		}
+		b.WriteString(val)
+		i = next
+	}
+	return b.String(), nil
+}
@@ -1,5 +1,5 @@
 /*
-Package route provides http package-compatible routing library. It can route http requests by hostname, method, path and headers.
+Package route provides http package-compatible routing library. It can route http requests by hostname, method, path, headers and query parameters.
 
 Route defines simple language for matching requests based on Go syntax. Route provides series of matchers that follow the syntax:
 
@@ -27,9 +27,17 @@ Header matcher:
 	Header("Content-Type", "application/<subtype>") // trie-based matcher for headers
 	HeaderRegexp("Content-Type", "application/.*")  // regexp based matcher for headers
 
-Matchers can be combined using && operator:
+Query matcher:
+
+	Query("version", "v<int:n>")       // trie-based matcher for URL query parameters
+	QueryRegexp("debug", "^(1|true)$") // regexp based matcher for URL query parameters
+	QueryExists("debug")               // matches if the query parameter is present
+
+Matchers can be combined using && and || operators, negated with ! operator and grouped with parentheses:
 
 	Host("localhost") && Method("POST") && Path("/v1")
+	Host("localhost") && (Path("/v1") || Path("/v2"))
+	Host("localhost") && !PathRegexp("^/internal/")
 
 Route library will join the trie-based matchers into one trie matcher when possible, for example:
 
@@ -41,14 +49,92 @@ Will be combined into one trie for performance. If you add a third route:
 	Host("localhost") && Method("GET") && PathRegexp("/v2/.*")
 
 It wont be joined ito the trie, and would be matched separately instead.
+
+Alternatives joined with || are compiled as separate routes sharing the same value,
+so each of them can be joined into the trie with the other routes.
+
+Routes are matched in the order of priority, set with Priority(n) pseudo-function or RouteOptions:
+
+	Priority(10) && PathRegexp("/.*") // matched before the routes with lower priority
+
+Routes with the same priority are ordered by specificity: routes checking more conditions go first,
+then trie-based routes go before the regexp-based ones, and the rest is ordered by expression text.
+Tries are merged within the same priority only.
+
+Values captured by the named trie patterns are returned by RouteWithParams:
+
+	Host("<tenant>.localhost") && Path("/users/<int:id>") // Params{{"tenant", "acme"}, {"id", "42"}}
+
+The trie patterns are <string:name> (or just <name>), <int:name> and <path:name>, matching the rest of the path,
+and the patterns matching the whole segment up to the separator:
+
+	<uuid:id>                // 123e4567-e89b-12d3-a456-426614174000
+	<hex:sha>                // hexadecimal digits
+	<alpha:slug>             // latin letters
+	<float:lat>              // decimal number with optional sign and fraction, e.g. -12.5
+	<enum:fmt:json|xml|csv>  // one of the values
+
+The <int:name> pattern needs at least one digit, so Path("/users/<int:id>") does not match /users/.
+The patterns never match the characters of the other request properties checked by the route,
+e.g. <path:rest> matches the rest of the path only in Path("/files/<path:rest>") && Method("GET").
+
+The int and string patterns take the optional constraints, the requests violating them don't match:
+
+	<int:page:1-500>           // numbers from 1 to 500
+	<string:code:len=2>        // strings of 2 characters
+	<string:name:min=2:max=64> // strings of 2 to 64 characters
+
+The <re:name:regexp> pattern matches the longest part of the segment matching the regular expression,
+and the shorter ones if the rest of the pattern does not match, so it can be followed by other characters
+of the segment, and the route stays in the merged trie, unlike the routes using PathRegexp.
+The segments longer than 1024 characters never match it:
+
+	Path("/files/<re:name:[a-z0-9_-]{1,64}>.txt")
+
+Other pattern types are added with RegisterPatternMatcher, e.g. <sku:id> for the matcher registered as sku.
+
+The path patterns can have the optional parts in brackets, and the optional trailing slash,
+they are expanded into the alternatives, which are merged into the tries like the alternatives joined with ||:
+
+	Path("/items[/<int:id>]") // matches /items and /items/42
+	Path("/users/?")          // matches /users and /users/
+
+The [, ] and the trailing /? used to be matched literally, such path patterns have to escape them
+with the backslash now, e.g. Path(`/legacy\[1\]`) matches /legacy[1].
+
+Explain shows the matchers evaluated while routing the request, which helps to find out why
+the request matched the route it did, or did not match any:
+
+	fmt.Println(r.Explain(req))
+
+Lint reports the routes that can never be matched, as the routes matched before them match
+all requests they do, the routes ending up in the same trie leaf and the overlapping regexps.
+Routes added with RouteOptions{Strict: true} are rejected if Lint reports any issues with them.
+
+Update applies several updates at once, either all of them become visible or none:
+
+	err := r.Update(func(tx route.Tx) error {
+		tx.Remove(`Path("/v1")`)
+		tx.Upsert(`Path("/v2")`, "v2")
+		return nil
+	})
+
+Router stores the values of any type, use TypedRouter for type-safe routing:
+
+	r := route.NewTyped[http.Handler]()
+	_ = r.AddRoute(`Path("/v1")`, handler)
+	h, ok, err := r.Route(req)
 */
 package route
 
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // Router implements http request routing and operations.
@@ -62,10 +148,14 @@ type Router interface {
 	// returns error if the expression already defined, or route expression is incorrect
 	AddRoute(string, interface{}) error
 
+	// AddRouteWithOptions works like AddRoute, but lets to set route options, e.g. priority
+	AddRouteWithOptions(string, interface{}, RouteOptions) error
+
 	// RemoveRoute removes a route for a given expression
 	RemoveRoute(string) error
 
-	// UpsertRoute updates an existing route or adds a new route by given expression
+	// UpsertRoute updates an existing route or adds a new route by given expression,
+	// the updated route keeps the options it was added with
 	UpsertRoute(string, interface{}) error
 
 	// InitRoutes Initializes the routes,
@@ -75,147 +165,541 @@ type Router interface {
 	// Route takes a request and matches it against requests, returns matched route in case if found,
 	// nil if there's no matching route or error in case of internal error.
 	Route(*http.Request) (interface{}, error)
+
+	// RouteWithParams works like Route, but returns the matched route along with the values
+	// captured by the named trie patterns, e.g. <int:id>. Returns nil if there's no matching route.
+	RouteWithParams(*http.Request) (*Match, error)
+
+	// RouteAll returns every route matching the request in the order they are matched in,
+	// the expressions with several matching alternatives are returned once.
+	RouteAll(*http.Request) []Match
+
+	// Update applies the updates staged by the function all at once, if the function or any
+	// of the updates fails, none of the updates is applied. The returned error lists every
+	// failed update. The function should not call the router methods.
+	Update(func(Tx) error) error
+
+	// Routes returns the routes in the order they are matched in
+	Routes() []RouteInfo
+
+	// Range calls the function for every route expression in the order they are matched in,
+	// until the function returns false
+	Range(func(expr string, val interface{}) bool)
+
+	// Explain routes the request like Route does, recording every matcher evaluated on the way
+	Explain(*http.Request) Trace
+
+	// Lint reports the problems with the routes, e.g. routes that can never be matched
+	Lint() []LintIssue
 }
 
+// RouteOptions are optional route properties
+type RouteOptions struct {
+	// Priority defines the order routes are matched in, routes with higher priority are matched first.
+	// Priority(n) in the expression takes precedence over this value.
+	Priority int
+	// Strict rejects the route if Lint reports any issues with it, e.g. if the route is unreachable
+	Strict bool
+}
+
+// TypedRouter is a type-safe version of the Router storing and returning the values of type T.
+type TypedRouter[T any] interface {
+	// GetRoute returns a route by a given expression, returns false if expression is not found
+	GetRoute(string) (T, bool)
+
+	// AddRoute adds a route to match by expression,
+	// returns error if the expression already defined, or route expression is incorrect
+	AddRoute(string, T) error
+
+	// AddRouteWithOptions works like AddRoute, but lets to set route options, e.g. priority
+	AddRouteWithOptions(string, T, RouteOptions) error
+
+	// RemoveRoute removes a route for a given expression
+	RemoveRoute(string) error
+
+	// UpsertRoute updates an existing route or adds a new route by given expression,
+	// the updated route keeps the options it was added with
+	UpsertRoute(string, T) error
+
+	// InitRoutes Initializes the routes,
+	// this method clobbers all existing routes and should only be called during init
+	InitRoutes(map[string]T) error
+
+	// Route takes a request and matches it against requests, returns matched route and true in case if found,
+	// false if there's no matching route or error in case of internal error.
+	Route(*http.Request) (T, bool, error)
+
+	// RouteWithParams works like Route, but returns the matched route along with the values
+	// captured by the named trie patterns, e.g. <int:id>. Returns nil if there's no matching route.
+	RouteWithParams(*http.Request) (*TypedMatch[T], error)
+
+	// RouteAll returns every route matching the request in the order they are matched in,
+	// the expressions with several matching alternatives are returned once.
+	RouteAll(*http.Request) []TypedMatch[T]
+
+	// Update applies the updates staged by the function all at once, if the function or any
+	// of the updates fails, none of the updates is applied. The returned error lists every
+	// failed update. The function should not call the router methods.
+	Update(func(TypedTx[T]) error) error
+
+	// Routes returns the routes in the order they are matched in
+	Routes() []TypedRouteInfo[T]
+
+	// Range calls the function for every route expression in the order they are matched in,
+	// until the function returns false
+	Range(func(expr string, val T) bool)
+
+	// Explain routes the request like Route does, recording every matcher evaluated on the way
+	Explain(*http.Request) Trace
+
+	// Lint reports the problems with the routes, e.g. routes that can never be matched
+	Lint() []LintIssue
+}
+
+// TypedMatch is the result of routing a request
+type TypedMatch[T any] struct {
+	// Expr is the expression of the matched route
+	Expr string
+	// Value is the value of the matched route
+	Value T
+	// Params are the values captured by the named trie patterns of the matched route
+	Params Params
+	// escaped are the indexes of the Params captured from the path with escape symbols
+	escaped []int
+}
+
+// pathValue returns the value of the parameter for http.Request.SetPathValue,
+// the path captures are unescaped like http.ServeMux does
+func (m *TypedMatch[T]) pathValue(k int) string {
+	for _, e := range m.escaped {
+		if e != k {
+			continue
+		}
+		if v, err := url.PathUnescape(m.Params[k].Value); err == nil {
+			return v
+		}
+	}
+	return m.Params[k].Value
+}
+
+// Match is the result of routing a request by Router
+type Match = TypedMatch[interface{}]
+
+// TypedRouteInfo describes the compiled route. The expressions with alternatives joined with ||
+// are compiled as separate routes, so they are listed once per alternative.
+type TypedRouteInfo[T any] struct {
+	// Expr is the route expression
+	Expr string
+	// Value is the value of the route
+	Value T
+	// Alternative is the index of the alternative in the expression, 0 for the expressions without ||
+	Alternative int
+	// Priority is the effective priority of the route
+	Priority int
+	// Merged is true if the route is merged into one trie with other routes,
+	// and false if the route is matched separately
+	Merged bool
+}
+
+// RouteInfo describes the route compiled by Router
+type RouteInfo = TypedRouteInfo[interface{}]
+
+// Param is a value captured by a named trie pattern, e.g. Path("/users/<int:id>")
+type Param struct {
+	Name  string
+	Value string
+}
+
+// Params is an ordered list of captured values, host captures go before path captures
+// in Host("<sub>.localhost") && Path("/<user>") and so on, following the expression order.
+type Params []Param
+
+// Get returns the value of the first parameter with the given name, or empty string if there's none
+func (p Params) Get(name string) string {
+	for _, param := range p {
+		if param.Name == name {
+			return param.Value
+		}
+	}
+	return ""
+}
+
+// router implements Router on top of the TypedRouter storing any values
 type router struct {
-	mutex    *sync.RWMutex
-	matchers []matcher
-	routes   map[string]*match
+	*typedRouter[interface{}]
 }
 
 // New creates a new Router instance
 func New() Router {
-	return &router{
-		mutex:  &sync.RWMutex{},
-		routes: make(map[string]*match),
-	}
+	return &router{typedRouter: newTypedRouter[interface{}]()}
 }
 
 func (r *router) GetRoute(expr string) interface{} {
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
+	val, _ := r.typedRouter.GetRoute(expr)
+	return val
+}
+
+func (r *router) Route(req *http.Request) (interface{}, error) {
+	val, _, err := r.typedRouter.Route(req)
+	return val, err
+}
+
+// typedRouter publishes the routes and the compiled matchers as immutable snapshots,
+// so the readers never block, while the writers compile the new snapshot.
+// Every route is parsed once, the writers update the compiled groups
+// affected by the route only.
+type typedRouter[T any] struct {
+	// mutex serializes the writers
+	mutex    *sync.Mutex
+	compiled atomic.Pointer[snapshot]
+}
+
+// snapshot is the immutable state of the router, the writers publish the modified copy
+type snapshot struct {
+	// routes are the parsed routes by expression
+	routes *routeIndex
+	// groups are the compiled routes in the order they are matched in
+	groups   []*group
+	matchers []matcher
+}
+
+// parsedRoute is the route expression parsed into the alternatives, see alternatives
+type parsedRoute struct {
+	val          interface{}
+	opts         RouteOptions
+	alternatives []*match
+	// clauses are parsed by Lint on demand
+	clauses     []clause
+	clausesOnce sync.Once
+}
+
+// NewTyped creates a new TypedRouter instance storing the values of type T
+func NewTyped[T any]() TypedRouter[T] {
+	return newTypedRouter[T]()
+}
+
+func newTypedRouter[T any]() *typedRouter[T] {
+	r := &typedRouter[T]{mutex: &sync.Mutex{}}
+	r.compiled.Store(&snapshot{routes: &routeIndex{}})
+	return r
+}
 
-	res, ok := r.routes[expr]
-	if ok {
-		return res.val
+func parseRoute(expr string, val interface{}, opts RouteOptions) (*parsedRoute, error) {
+	result := &match{val: val, priority: opts.Priority}
+	m, err := parse(expr, result)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	route := &parsedRoute{val: val, opts: opts}
+	for i, alt := range alternatives(m) {
+		// Every alternative gets its own result, so the merged tries order them as the router does
+		res := &match{val: val, priority: result.priority, expr: expr, alt: i, matcher: alt, conditions: conditions(alt)}
+		alt.setMatch(res)
+		route.alternatives = append(route.alternatives, res)
+	}
+	return route, nil
 }
 
-func (r *router) InitRoutes(routes map[string]interface{}) error {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
+func (r *typedRouter[T]) GetRoute(expr string) (T, bool) {
+	if res := r.compiled.Load().routes.lookup(expr); res != nil {
+		return value[T](res.val), true
+	}
+	var zero T
+	return zero, false
+}
 
-	r.routes = make(map[string]*match, len(routes))
+func (r *typedRouter[T]) InitRoutes(routes map[string]T) error {
+	parsed := make(map[string]*parsedRoute, len(routes))
+	var alts []*match
 	for expr, val := range routes {
-		result := &match{val: val}
-		if _, err := parse(expr, result); err != nil {
+		route, err := parseRoute(expr, val, RouteOptions{})
+		if err != nil {
 			return err
 		}
-		r.routes[expr] = result
+		parsed[expr] = route
+		alts = append(alts, route.alternatives...)
 	}
-
-	if err := r.compile(); err != nil {
+	sort.Slice(alts, func(i, j int) bool {
+		return alts[i].less(alts[j])
+	})
+	groups, err := compile(alts)
+	if err != nil {
 		return err
 	}
 
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.publish((&routeIndex{}).with(parsed), groups)
 	return nil
 }
 
-func (r *router) AddRoute(expr string, val interface{}) error {
+func (r *typedRouter[T]) AddRoute(expr string, val T) error {
+	return r.AddRouteWithOptions(expr, val, RouteOptions{})
+}
+
+func (r *typedRouter[T]) AddRouteWithOptions(expr string, val T, opts RouteOptions) error {
+	route, err := parseRoute(expr, val, opts)
+	if err != nil {
+		return err
+	}
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	if _, ok := r.routes[expr]; ok {
+	s := r.compiled.Load()
+	if s.routes.lookup(expr) != nil {
 		return fmt.Errorf("expression '%s' already exists", expr)
 	}
-	result := &match{val: val}
-	if _, err := parse(expr, result); err != nil {
+	groups, err := route.addTo(s.groups)
+	if err != nil {
 		return err
 	}
-	r.routes[expr] = result
-	if err := r.compile(); err != nil {
-		delete(r.routes, expr)
-		return err
+	routes := s.routes.with(map[string]*parsedRoute{expr: route})
+	if opts.Strict {
+		if err := checkStrict(groups, routes.lookup, expr); err != nil {
+			return err
+		}
 	}
+	r.publish(routes, groups)
 	return nil
 }
 
-func (r *router) UpsertRoute(expr string, val interface{}) error {
+// checkStrict returns the error listing the Lint issues of the route added with RouteOptions{Strict: true}
+func checkStrict(groups []*group, lookup func(string) *parsedRoute, expr string) error {
+	issues := lint(groups, lookup, expr)
+	if len(issues) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(issues))
+	for i, issue := range issues {
+		msgs[i] = issue.String()
+	}
+	return fmt.Errorf("expression '%s' is rejected: %s", expr, strings.Join(msgs, "; "))
+}
+
+func (r *typedRouter[T]) UpsertRoute(expr string, val T) error {
+	route, err := parseRoute(expr, val, RouteOptions{})
+	if err != nil {
+		return err
+	}
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	result := &match{val: val}
-	if _, err := parse(expr, result); err != nil {
+	s := r.compiled.Load()
+	groups := s.groups
+	if prev := s.routes.lookup(expr); prev != nil {
+		if groups, err = prev.removeFrom(groups); err != nil {
+			return err
+		}
+		if route, err = route.withOptions(expr, prev.opts); err != nil {
+			return err
+		}
+	}
+	if groups, err = route.addTo(groups); err != nil {
 		return err
 	}
-	prev, existed := r.routes[expr]
-
-	r.routes[expr] = result
-	if err := r.compile(); err != nil {
-		if existed {
-			r.routes[expr] = prev
-		} else {
-			delete(r.routes, expr)
+	routes := s.routes.with(map[string]*parsedRoute{expr: route})
+	if route.opts.Strict {
+		if err := checkStrict(groups, routes.lookup, expr); err != nil {
+			return err
 		}
+	}
+	r.publish(routes, groups)
+	return nil
+}
+
+func (r *typedRouter[T]) RemoveRoute(expr string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s := r.compiled.Load()
+	route := s.routes.lookup(expr)
+	if route == nil {
+		return nil
+	}
+	groups, err := route.removeFrom(s.groups)
+	if err != nil {
 		return err
 	}
+	r.publish(s.routes.with(map[string]*parsedRoute{expr: nil}), groups)
 	return nil
 }
 
-func (r *router) compile() error {
-	var exprs []string
-	for expr := range r.routes {
-		exprs = append(exprs, expr)
+func (r *typedRouter[T]) Routes() []TypedRouteInfo[T] {
+	var out []TypedRouteInfo[T]
+	for _, g := range r.compiled.Load().groups {
+		for _, m := range g.routes() {
+			out = append(out, TypedRouteInfo[T]{
+				Expr:        m.expr,
+				Value:       value[T](m.val),
+				Alternative: m.alt,
+				Priority:    m.priority,
+				Merged:      g.first != g.last,
+			})
+		}
 	}
-	sort.Sort(sort.Reverse(sort.StringSlice(exprs)))
+	return out
+}
 
-	var matchers []matcher
-	i := 0
-	for _, expr := range exprs {
-		result := r.routes[expr]
-		matcher, err := parse(expr, result)
-		if err != nil {
-			return err
+func (r *typedRouter[T]) Range(fn func(expr string, val T) bool) {
+	seen := make(map[string]bool)
+	for _, route := range r.Routes() {
+		// The expression is listed at the position of its first matched alternative
+		if seen[route.Expr] {
+			continue
+		}
+		seen[route.Expr] = true
+		if !fn(route.Expr, route.Value) {
+			return
 		}
+	}
+}
+
+// publish publishes the new snapshot of the routes and the compiled groups, should be called by the writers holding the mutex
+func (r *typedRouter[T]) publish(routes *routeIndex, groups []*group) {
+	r.compiled.Store(&snapshot{routes: routes, groups: groups, matchers: matchers(groups)})
+}
+
+// routeShards is the amount of the shards of the route index
+const routeShards = 256
+
+// routeIndex is the immutable index of the parsed routes by expression, split into the shards by the hash
+// of the expression. The updated index shares the unchanged shards with the previous one,
+// so the update copies the shards of the changed expressions only.
+type routeIndex struct {
+	shards [routeShards]map[string]*parsedRoute
+}
+
+// shard returns the shard of the expression, see FNV-1a
+func shard(expr string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(expr); i++ {
+		h ^= uint32(expr[i])
+		h *= 16777619
+	}
+	return int(h % routeShards)
+}
 
-		// Merge the previous and new matcher if that's possible
-		if i > 0 && matchers[i-1].canMerge(matcher) {
-			m, err := matchers[i-1].merge(matcher)
-			if err != nil {
-				return err
+// lookup returns the route by expression, nil if it's not found
+func (x *routeIndex) lookup(expr string) *parsedRoute {
+	return x.shards[shard(expr)][expr]
+}
+
+// with returns the index with the changes applied, nil changes remove the routes
+func (x *routeIndex) with(changes map[string]*parsedRoute) *routeIndex {
+	out := *x
+	copied := make(map[int]bool)
+	for expr, route := range changes {
+		i := shard(expr)
+		if !copied[i] {
+			copied[i] = true
+			m := make(map[string]*parsedRoute, len(out.shards[i])+1)
+			for e, r := range out.shards[i] {
+				m[e] = r
 			}
-			matchers[i-1] = m
+			out.shards[i] = m
+		}
+		if route == nil {
+			delete(out.shards[i], expr)
 		} else {
-			matchers = append(matchers, matcher)
-			i += 1
+			out.shards[i][expr] = route
 		}
 	}
+	return &out
+}
 
-	r.matchers = matchers
-	return nil
+// each calls the function for every route of the index
+func (x *routeIndex) each(fn func(expr string, route *parsedRoute)) {
+	for _, m := range x.shards {
+		for expr, route := range m {
+			fn(expr, route)
+		}
+	}
 }
 
-func (r *router) RemoveRoute(expr string) error {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
+// withOptions returns the route parsed with the options, the upserted routes keep the options they were added with
+func (p *parsedRoute) withOptions(expr string, opts RouteOptions) (*parsedRoute, error) {
+	if p.opts == opts {
+		return p, nil
+	}
+	return parseRoute(expr, p.val, opts)
+}
 
-	delete(r.routes, expr)
-	return r.compile()
+// addTo returns the compiled groups with the route added
+func (p *parsedRoute) addTo(groups []*group) ([]*group, error) {
+	var err error
+	for _, alt := range p.alternatives {
+		if groups, err = insertRoute(groups, alt); err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
 }
 
-func (r *router) Route(req *http.Request) (interface{}, error) {
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
+// removeFrom returns the compiled groups with the route removed
+func (p *parsedRoute) removeFrom(groups []*group) ([]*group, error) {
+	var err error
+	for _, alt := range p.alternatives {
+		if groups, err = removeRoute(groups, alt); err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
 
-	if len(r.matchers) == 0 {
-		return nil, nil
+func (r *typedRouter[T]) Route(req *http.Request) (T, bool, error) {
+	if l := r.route(req, nil); l != nil {
+		return value[T](l.val), true, nil
 	}
+	var zero T
+	return zero, false, nil
+}
 
-	for _, m := range r.matchers {
-		if l := m.match(req); l != nil {
-			return l.val, nil
-		}
+func (r *typedRouter[T]) RouteWithParams(req *http.Request) (*TypedMatch[T], error) {
+	st := &matchState{}
+	if l := r.route(req, st); l != nil {
+		return &TypedMatch[T]{Expr: l.expr, Value: value[T](l.val), Params: st.params, escaped: st.escaped}, nil
 	}
 	return nil, nil
 }
+
+func (r *typedRouter[T]) RouteAll(req *http.Request) []TypedMatch[T] {
+	var out []TypedMatch[T]
+	seen := make(map[string]bool)
+	add := func(l *match, params Params) {
+		if !seen[l.expr] {
+			seen[l.expr] = true
+			out = append(out, TypedMatch[T]{Expr: l.expr, Value: value[T](l.val), Params: params})
+		}
+	}
+	for _, m := range r.compiled.Load().matchers {
+		// the merged tries match several routes, other matchers match a single route
+		if t, ok := m.(*trie); ok {
+			t.matchAll(req, add)
+			continue
+		}
+		st := &matchState{}
+		if l := m.match(req, st); l != nil {
+			add(l, st.params)
+		}
+	}
+	return out
+}
+
+func (r *typedRouter[T]) route(req *http.Request, st *matchState) *match {
+	for _, m := range r.compiled.Load().matchers {
+		if l := m.match(req, st); l != nil {
+			return l
+		}
+	}
+	return nil
+}
+
+// value returns the value of the matched route, the router stores the values of type T only,
+// the check is for nil values stored in the router of interface type
+func value[T any](val interface{}) T {
+	v, _ := val.(T)
+	return v
+}
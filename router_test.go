@@ -2,10 +2,17 @@ package route
 
 import (
 	"fmt"
+	"math/rand"
 	"net/http"
+	"reflect"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -380,6 +387,153 @@ func (s *RouteSuite) TestMatchCases() {
 				},
 			},
 		},
+		{
+			name: "Alternatives are merged into the trie",
+			routes: []route{
+				{expr: `Path("/r1") || Path("/r2")`, match: "m1"},
+				{expr: `Path("/r3")`, match: "m2"},
+			},
+			expected: 1,
+			tries: []try{
+				{
+					r:     req{url: "http://google.com/r1"},
+					match: "m1",
+				},
+				{
+					r:     req{url: "http://google.com/r2"},
+					match: "m1",
+				},
+				{
+					r:     req{url: "http://google.com/r3"},
+					match: "m2",
+				},
+				{
+					r: req{url: "http://google.com/r4"},
+				},
+			},
+		},
+		{
+			name: "Grouped alternatives are chained and merged into the trie",
+			routes: []route{
+				{expr: `Host("h1") && (Method("POST") || Method("PUT")) && Path("/r1")`, match: "m1"},
+				{expr: `Host("h1") && Method("GET") && Path("/r1")`, match: "m2"},
+			},
+			expected: 1,
+			tries: []try{
+				{
+					r:     req{url: "http://h1/r1", method: http.MethodPost, host: "h1"},
+					match: "m1",
+				},
+				{
+					r:     req{url: "http://h1/r1", method: http.MethodPut, host: "h1"},
+					match: "m1",
+				},
+				{
+					r:     req{url: "http://h1/r1", method: http.MethodGet, host: "h1"},
+					match: "m2",
+				},
+				{
+					r: req{url: "http://h1/r1", method: http.MethodDelete, host: "h1"},
+				},
+			},
+		},
+		{
+			name: "Alternatives with regular expressions",
+			routes: []route{
+				{expr: `PathRegexp("/r1.*") || Path("/r2")`, match: "m1"},
+			},
+			expected: 2,
+			tries: []try{
+				{
+					r:     req{url: "http://google.com/r1/hello"},
+					match: "m1",
+				},
+				{
+					r:     req{url: "http://google.com/r2"},
+					match: "m1",
+				},
+				{
+					r: req{url: "http://google.com/r3"},
+				},
+			},
+		},
+		{
+			name: "Negated matcher is matched separately",
+			routes: []route{
+				{expr: `Host("h1") && !PathRegexp("^/internal/")`, match: "m1"},
+				{expr: `Host("h1") && Path("/internal/status")`, match: "m2"},
+				{expr: `Host("h1") && Path("/public")`, match: "m3"},
+			},
+			expected: 2,
+			tries: []try{
+				{
+					r:     req{url: "http://h1/internal/status", host: "h1"},
+					match: "m2",
+				},
+				{
+					r:     req{url: "http://h1/public", host: "h1"},
+					match: "m3",
+				},
+				{
+					r:     req{url: "http://h1/other", host: "h1"},
+					match: "m1",
+				},
+				{
+					r: req{url: "http://h1/internal/other", host: "h1"},
+				},
+			},
+		},
+		{
+			name: "Match by path and query",
+			routes: []route{
+				{expr: `Method("GET") && Path("/r1") && Query("version", "v<int:n>")`, match: "m1"},
+				{expr: `Method("GET") && Path("/r1") && Query("version", "latest")`, match: "m2"},
+				{expr: `Method("GET") && Path("/r1")`, match: "m3"},
+			},
+			expected: 1,
+			tries: []try{
+				{
+					r:     req{url: "http://h1/r1?version=v1", method: http.MethodGet},
+					match: "m1",
+				},
+				{
+					r:     req{url: "http://h1/r1?version=latest", method: http.MethodGet},
+					match: "m2",
+				},
+				{
+					r:     req{url: "http://h1/r1", method: http.MethodGet},
+					match: "m3",
+				},
+			},
+		},
+		{
+			name: "Chained tries with different mappers are not merged",
+			routes: []route{
+				{expr: `Host("h1") && Path("/r1")`, match: "m1"},
+				{expr: `Host("h1") && Method("GET")`, match: "m2"},
+				{expr: `Path("/r1") && Query("version", "1")`, match: "m3"},
+				{expr: `Path("/r1") && Header("Version", "2")`, match: "m4"},
+			},
+			expected: 4,
+			tries: []try{
+				{
+					r:     req{url: "http://h1/r1", method: http.MethodPost, host: "h1"},
+					match: "m1",
+				},
+				{
+					r:     req{url: "http://h1/r2", method: http.MethodGet, host: "h1"},
+					match: "m2",
+				},
+				{
+					r:     req{url: "http://h1/r1?version=1"},
+					match: "m3",
+				},
+				{
+					r:     req{url: "http://h1/r1", headers: http.Header{"Version": []string{"2"}}},
+					match: "m4",
+				},
+			},
+		},
 		{
 			name: "Make sure there is no match overlap",
 			routes: []route{
@@ -401,7 +555,7 @@ func (s *RouteSuite) TestMatchCases() {
 			s.Nil(r.AddRoute(rt.expr, rt.match), comment)
 		}
 		if test.expected != 0 {
-			s.Len(r.matchers, test.expected, comment)
+			s.Len(r.compiled.Load().matchers, test.expected, comment)
 		}
 
 		for _, a := range test.tries {
@@ -418,6 +572,574 @@ func (s *RouteSuite) TestMatchCases() {
 	}
 }
 
+func (s *RouteSuite) TestRouteWithParams() {
+	r := New()
+
+	s.Nil(r.AddRoute(`Host("<tenant>.example.com") && Method("GET") && Path("/users/<int:id>/<path:rest>")`, "m1"))
+	s.Nil(r.AddRoute(`HostRegexp(".*") && Path("/files/<name>")`, "m2"))
+	s.Nil(r.AddRoute(`Path("/users/<user>") && Header("Content-Type", "application/<subtype>")`, "m3"))
+
+	tc := []struct {
+		name   string
+		r      req
+		match  string
+		params Params
+	}{
+		{
+			name:  "chained trie",
+			r:     req{url: "http://acme.example.com/users/42/a/b", method: http.MethodGet, host: "acme.example.com"},
+			match: "m1",
+			params: Params{
+				{Name: "tenant", Value: "acme"},
+				{Name: "id", Value: "42"},
+				{Name: "rest", Value: "a/b"},
+			},
+		},
+		{
+			name:   "trie combined with regexp",
+			r:      req{url: "http://localhost/files/readme", host: "localhost"},
+			match:  "m2",
+			params: Params{{Name: "name", Value: "readme"}},
+		},
+		{
+			name:  "path and header",
+			r:     req{url: "http://localhost/users/bob", headers: http.Header{"Content-Type": []string{"application/json"}}},
+			match: "m3",
+			params: Params{
+				{Name: "user", Value: "bob"},
+				{Name: "subtype", Value: "json"},
+			},
+		},
+		{
+			name: "no match",
+			r:    req{url: "http://localhost/users/bob"},
+		},
+	}
+	for _, test := range tc {
+		out, err := r.RouteWithParams(makeReq(test.r))
+		s.Nil(err, test.name)
+		if test.match == "" {
+			s.Nil(out, test.name)
+			continue
+		}
+		s.Require().NotNil(out, test.name)
+		s.Equal(test.match, out.Value, test.name)
+		s.Equal(test.params, out.Params, test.name)
+	}
+
+	out, err := r.RouteWithParams(makeReq(req{url: "http://acme.example.com/users/42/x", method: http.MethodGet, host: "acme.example.com"}))
+	s.Nil(err)
+	s.Equal("acme", out.Params.Get("tenant"))
+	s.Equal("", out.Params.Get("missing"))
+}
+
+func (s *RouteSuite) TestPriority() {
+	r := New().(*router)
+
+	s.Nil(r.AddRoute(`Path("/a")`, "trie"))
+	s.Nil(r.AddRoute(`Path("/b")`, "trie"))
+	s.Nil(r.AddRoute(`PathRegexp("/.*")`, "regexp"))
+	s.Nil(r.AddRoute(`Host("h1") && PathRegexp("/b.*")`, "host"))
+	s.Nil(r.AddRoute(`Priority(10) && Path("/c")`, "priority"))
+	s.Nil(r.AddRouteWithOptions(`Path("/d")`, "options", RouteOptions{Priority: 10}))
+	s.Nil(r.AddRouteWithOptions(`Priority(1) && Path("/e")`, "expression", RouteOptions{Priority: 20}))
+	s.Nil(r.AddRouteWithOptions(`PathRegexp("/e")`, "band", RouteOptions{Priority: 5}))
+
+	// Tries are merged within the same priority
+	s.Len(r.compiled.Load().matchers, 6)
+
+	tc := []struct {
+		r     req
+		match string
+	}{
+		// tries go before regexps
+		{r: req{url: "http://h1/a"}, match: "trie"},
+		{r: req{url: "http://h1/b"}, match: "trie"},
+		{r: req{url: "http://h1/x"}, match: "regexp"},
+		// more specific route goes first
+		{r: req{url: "http://h1/b", host: "h1"}, match: "host"},
+		{r: req{url: "http://h1/c", host: "h1"}, match: "priority"},
+		{r: req{url: "http://h1/d", host: "h1"}, match: "options"},
+		// expression takes precedence over the options
+		{r: req{url: "http://h1/e", host: "h1"}, match: "band"},
+	}
+	for _, test := range tc {
+		out, err := r.Route(makeReq(test.r))
+		s.Nil(err)
+		s.Equal(test.match, out, test.r.url)
+	}
+
+	s.Nil(r.AddRouteWithOptions(`PathRegexp("/.*") && Method("GET")`, "catch all", RouteOptions{Priority: 100}))
+	out, err := r.Route(makeReq(req{url: "http://h1/c", method: http.MethodGet}))
+	s.Nil(err)
+	s.Equal("catch all", out)
+
+	// the upserted routes keep the priority they were added with
+	s.Nil(r.UpsertRoute(`PathRegexp("/.*") && Method("GET")`, "upserted"))
+	s.Nil(r.Update(func(tx Tx) error {
+		tx.Upsert(`Path("/d")`, "updated")
+		return nil
+	}))
+	for _, test := range []struct{ url, match string }{{url: "http://h1/a", match: "upserted"}, {url: "http://h1/e", match: "upserted"}} {
+		out, err = r.Route(makeReq(req{url: test.url, method: http.MethodGet}))
+		s.Nil(err)
+		s.Equal(test.match, out, test.url)
+	}
+	out, err = r.Route(makeReq(req{url: "http://h1/d", host: "h1"}))
+	s.Nil(err)
+	s.Equal("updated", out)
+	for _, route := range r.Routes() {
+		if route.Expr == `Path("/d")` {
+			s.Equal(10, route.Priority)
+		}
+	}
+}
+
+func (s *RouteSuite) TestTypedRouter() {
+	r := NewTyped[int]()
+
+	s.Nil(r.AddRoute(`Path("/r1")`, 1))
+	s.Nil(r.UpsertRoute(`Path("/r2/<id>")`, 2))
+
+	v, ok := r.GetRoute(`Path("/r1")`)
+	s.True(ok)
+	s.Equal(1, v)
+
+	_, ok = r.GetRoute(`Path("/r3")`)
+	s.False(ok)
+
+	v, ok, err := r.Route(makeReq(req{url: "http://google.com/r1"}))
+	s.Nil(err)
+	s.True(ok)
+	s.Equal(1, v)
+
+	v, ok, err = r.Route(makeReq(req{url: "http://google.com/r3"}))
+	s.Nil(err)
+	s.False(ok)
+	s.Equal(0, v)
+
+	m, err := r.RouteWithParams(makeReq(req{url: "http://google.com/r2/a"}))
+	s.Nil(err)
+	s.Equal(&TypedMatch[int]{Expr: `Path("/r2/<id>")`, Value: 2, Params: Params{{Name: "id", Value: "a"}}}, m)
+}
+
+func (s *RouteSuite) TestNilValue() {
+	r := New()
+
+	s.Nil(r.AddRoute(`Path("/r1")`, nil))
+	out, err := r.Route(makeReq(req{url: "http://google.com/r1"}))
+	s.Nil(err)
+	s.Nil(out)
+}
+
+func (s *RouteSuite) TestConcurrentUpdates() {
+	r := New()
+	s.Nil(r.AddRoute(`Path("/static")`, "static"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				expr := fmt.Sprintf(`Path("/r%d/%d")`, i, j)
+				s.Nil(r.UpsertRoute(expr, expr))
+				if j%2 == 0 {
+					s.Nil(r.RemoveRoute(expr))
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				out, err := r.Route(makeReq(req{url: "http://google.com/static"}))
+				s.Nil(err)
+				s.Equal("static", out)
+			}
+		}()
+	}
+	wg.Wait()
+
+	out, err := r.Route(makeReq(req{url: "http://google.com/r3/49"}))
+	s.Nil(err)
+	s.Equal(`Path("/r3/49")`, out)
+	s.Nil(r.GetRoute(`Path("/r3/48")`))
+}
+
+func (s *RouteSuite) TestRouteIndex() {
+	a, b := &parsedRoute{val: "a"}, &parsedRoute{val: "b"}
+	x := (&routeIndex{}).with(map[string]*parsedRoute{`Path("/a")`: a})
+	y := x.with(map[string]*parsedRoute{`Path("/b")`: b, `Path("/a")`: nil})
+
+	// the updated index does not change the previous one
+	s.Equal(a, x.lookup(`Path("/a")`))
+	s.Nil(x.lookup(`Path("/b")`))
+	s.Nil(y.lookup(`Path("/a")`))
+	s.Equal(b, y.lookup(`Path("/b")`))
+
+	// the unchanged shards are shared
+	z := y.with(map[string]*parsedRoute{`Path("/c")`: a})
+	if shard(`Path("/c")`) != shard(`Path("/b")`) {
+		s.Equal(reflect.ValueOf(y.shards[shard(`Path("/b")`)]).Pointer(), reflect.ValueOf(z.shards[shard(`Path("/b")`)]).Pointer())
+	}
+}
+
+func (s *RouteSuite) TestReadersDoNotBlock() {
+	r := newTypedRouter[interface{}]()
+	s.Nil(r.AddRoute(`Path("/a")`, "a"))
+
+	// the writer holds the mutex while compiling the routes
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		out, ok := r.GetRoute(`Path("/a")`)
+		s.True(ok)
+		s.Equal("a", out)
+		s.Len(r.Routes(), 1)
+		r.Range(func(string, interface{}) bool { return true })
+		s.Empty(r.Lint())
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		s.Fail("readers are blocked by the writer")
+	}
+}
+
+func (s *RouteSuite) TestUpdate() {
+	r := New()
+	s.Nil(r.AddRoute(`Path("/a")`, "a"))
+	s.Nil(r.AddRoute(`Path("/b")`, "b"))
+
+	err := r.Update(func(tx Tx) error {
+		tx.Remove(`Path("/a")`)
+		tx.Upsert(`Path("/b")`, "b2")
+		tx.Add(`Path("/c")`, "c")
+		tx.AddWithOptions(`PathRegexp("/.*")`, "any", RouteOptions{Priority: -1})
+		// the routes can be removed and added again within the transaction
+		tx.Remove(`Path("/c")`)
+		tx.Add(`Path("/c")`, "c2")
+		return nil
+	})
+	s.Nil(err)
+
+	s.Nil(r.GetRoute(`Path("/a")`))
+	s.Equal("b2", r.GetRoute(`Path("/b")`))
+	s.Equal("c2", r.GetRoute(`Path("/c")`))
+
+	for path, expected := range map[string]string{"/a": "any", "/b": "b2", "/c": "c2"} {
+		out, err := r.Route(makeReq(req{url: "http://google.com" + path}))
+		s.Nil(err)
+		s.Equal(expected, out)
+	}
+}
+
+func (s *RouteSuite) TestUpdateFailsAtomically() {
+	r := New()
+	s.Nil(r.AddRoute(`Path("/a")`, "a"))
+
+	err := r.Update(func(tx Tx) error {
+		tx.Remove(`Path("/a")`)
+		tx.Add(`Path("/b")`, "b")
+		tx.Add(`Path("/b")`, "b2")
+		tx.Upsert(`Path(`, "bad")
+		tx.Add(`Host("h") || Bad("x")`, "bad")
+		return nil
+	})
+	s.Require().Error(err)
+	s.Contains(err.Error(), "expression 'Path('")
+	s.Contains(err.Error(), `expression 'Host("h") || Bad("x")'`)
+	s.Contains(err.Error(), `expression 'Path("/b")' already exists`)
+
+	s.Equal("a", r.GetRoute(`Path("/a")`))
+	s.Nil(r.GetRoute(`Path("/b")`))
+	out, err := r.Route(makeReq(req{url: "http://google.com/a"}))
+	s.Nil(err)
+	s.Equal("a", out)
+
+	// the error returned by the function discards the updates
+	err = r.Update(func(tx Tx) error {
+		tx.Remove(`Path("/a")`)
+		return fmt.Errorf("oops")
+	})
+	s.EqualError(err, "oops")
+	s.Equal("a", r.GetRoute(`Path("/a")`))
+}
+
+func (s *RouteSuite) TestRoutes() {
+	r := New()
+	s.Nil(r.AddRoute(`Path("/a")`, "a"))
+	s.Nil(r.AddRoute(`Path("/b") || PathRegexp("/c.*")`, "bc"))
+	s.Nil(r.AddRoute(`Host("h") && Path("/a")`, "ha"))
+	s.Nil(r.AddRouteWithOptions(`PathRegexp("/.*")`, "any", RouteOptions{Priority: 1}))
+
+	s.Equal([]RouteInfo{
+		{Expr: `PathRegexp("/.*")`, Value: "any", Priority: 1},
+		{Expr: `Host("h") && Path("/a")`, Value: "ha"},
+		{Expr: `Path("/b") || PathRegexp("/c.*")`, Value: "bc", Merged: true},
+		{Expr: `Path("/a")`, Value: "a", Merged: true},
+		{Expr: `Path("/b") || PathRegexp("/c.*")`, Value: "bc", Alternative: 1},
+	}, r.Routes())
+
+	var exprs []string
+	r.Range(func(expr string, val interface{}) bool {
+		exprs = append(exprs, expr)
+		return len(exprs) < 3
+	})
+	s.Equal([]string{`PathRegexp("/.*")`, `Host("h") && Path("/a")`, `Path("/b") || PathRegexp("/c.*")`}, exprs)
+
+	exprs = nil
+	r.Range(func(expr string, val interface{}) bool {
+		exprs = append(exprs, expr)
+		return true
+	})
+	s.Len(exprs, 4)
+
+	s.Empty(New().Routes())
+}
+
+func (s *RouteSuite) TestExplain() {
+	r := New()
+	s.Nil(r.AddRoute(`Host("localhost") && Path("/users/<int:id>")`, "user"))
+	s.Nil(r.AddRoute(`PathRegexp("/v.*") && !Method("POST")`, "v"))
+
+	trace := r.Explain(makeReq(req{url: "/v1", host: "localhost", method: "GET"}))
+	s.True(trace.Matched)
+	s.Equal(`PathRegexp("/v.*") && !Method("POST")`, trace.Expr)
+	s.Equal([]TraceStep{
+		{
+			Matcher: "trie", Mapper: "Host+Path", Input: "localhost /v1",
+			Walk: []string{"root(0)", "node(0:l)", "node(0:o)", "node(0:c)", "node(0:a)", "node(0:l)",
+				"node(0:h)", "node(0:o)", "node(0:s)", "node(0:t)", "root(1)", "node(1:/)"},
+		},
+		{Matcher: "and", Matched: true, Expr: trace.Expr},
+		{Depth: 1, Matcher: "regexp", Mapper: "Path", Input: "/v1", Pattern: "/v.*", Matched: true, Expr: trace.Expr},
+		{Depth: 1, Matcher: "not", Matched: true, Expr: trace.Expr},
+		{Depth: 2, Matcher: "trie", Mapper: "Method", Input: "GET", Walk: []string{"root(0)"}},
+	}, trace.Steps)
+
+	trace = r.Explain(makeReq(req{url: "/users/42", host: "localhost"}))
+	s.True(trace.Matched)
+	s.Equal(Params{{Name: "id", Value: "42"}}, trace.Params)
+	s.Len(trace.Steps, 1)
+	s.Equal("match(1:<int:id>)", trace.Steps[0].Walk[len(trace.Steps[0].Walk)-1])
+	s.True(strings.HasSuffix(trace.String(), `: matched Host("localhost") && Path("/users/<int:id>")
+route Host("localhost") && Path("/users/<int:id>") matched with id="42"
+`))
+
+	trace = r.Explain(makeReq(req{url: "/a", host: "localhost", method: "GET"}))
+	s.False(trace.Matched)
+	s.Equal(`trie Host+Path "localhost /a" walk root(0) node(0:l) node(0:o) node(0:c) node(0:a) node(0:l) node(0:h) node(0:o) node(0:s) node(0:t) root(1) node(1:/): no match
+and: no match
+  regexp Path "/a" "/v.*": no match
+no route matched
+`, trace.String())
+}
+
+func (s *RouteSuite) TestRouteAll() {
+	r := New()
+	s.Nil(r.AddRoute(`Host("localhost") && Path("/users/<int:id>")`, "user"))
+	s.Nil(r.AddRoute(`Host("localhost")`, "host"))
+	s.Nil(r.AddRoute(`Path("/users/<string:name>")`, "name"))
+	s.Nil(r.AddRoute(`Path("/users/<int:id>") || PathRegexp("^/users/")`, "users"))
+	s.Nil(r.AddRoute(`PathRegexp("^/admin")`, "admin"))
+	s.Nil(r.AddRouteWithOptions(`Method("GET")`, "get", RouteOptions{Priority: 1}))
+
+	out := r.RouteAll(makeReq(req{url: "/users/42", host: "localhost", method: "GET"}))
+	s.Equal([]Match{
+		{Expr: `Method("GET")`, Value: "get"},
+		{Expr: `Host("localhost") && Path("/users/<int:id>")`, Value: "user", Params: Params{{Name: "id", Value: "42"}}},
+		{Expr: `Path("/users/<string:name>")`, Value: "name", Params: Params{{Name: "name", Value: "42"}}},
+		{Expr: `Path("/users/<int:id>") || PathRegexp("^/users/")`, Value: "users", Params: Params{{Name: "id", Value: "42"}}},
+		{Expr: `Host("localhost")`, Value: "host"},
+	}, out)
+
+	// the first of the routes is the one Route returns
+	m, err := r.RouteWithParams(makeReq(req{url: "/users/42", host: "localhost", method: "GET"}))
+	s.Nil(err)
+	s.Equal(out[0], *m)
+
+	out = r.RouteAll(makeReq(req{url: "/users/bob", method: "POST"}))
+	s.Equal([]Match{
+		{Expr: `Path("/users/<string:name>")`, Value: "name", Params: Params{{Name: "name", Value: "bob"}}},
+		{Expr: `Path("/users/<int:id>") || PathRegexp("^/users/")`, Value: "users"},
+	}, out)
+
+	s.Empty(r.RouteAll(makeReq(req{url: "/other", method: "POST"})))
+}
+
+func (s *RouteSuite) TestOptionalPathParts() {
+	r := New()
+	s.Nil(r.AddRoute(`Host("localhost") && Path("/items[/<int:id>]")`, "items"))
+	s.Nil(r.AddRoute(`Host("localhost") && Path("/users/?")`, "users"))
+	s.Nil(r.AddRoute(`Host("localhost") && Path("/items/<int:id>/reviews")`, "reviews"))
+
+	// the alternatives the optional parts expand into are merged into one trie
+	var alts []string
+	for _, route := range r.Routes() {
+		s.True(route.Merged, route.Expr)
+		alts = append(alts, fmt.Sprintf("%s/%d", route.Value, route.Alternative))
+	}
+	s.ElementsMatch([]string{"items/0", "items/1", "users/0", "users/1", "reviews/0"}, alts)
+
+	tc := []struct {
+		url    string
+		val    interface{}
+		params Params
+	}{
+		{url: "/items", val: "items"},
+		{url: "/items/42", val: "items", params: Params{{Name: "id", Value: "42"}}},
+		{url: "/items/42/reviews", val: "reviews", params: Params{{Name: "id", Value: "42"}}},
+		{url: "/users", val: "users"},
+		{url: "/users/", val: "users"},
+		{url: "/items/", val: nil},
+		{url: "/users//", val: nil},
+	}
+	for _, t := range tc {
+		m, err := r.RouteWithParams(makeReq(req{url: t.url, host: "localhost"}))
+		s.Nil(err)
+		if t.val == nil {
+			s.Nil(m, t.url)
+			continue
+		}
+		s.Require().NotNil(m, t.url)
+		s.Equal(t.val, m.Value, t.url)
+		s.Equal(t.params, m.Params, t.url)
+	}
+
+	// the expanded alternatives are linted as the router compiles them
+	s.Nil(r.AddRoute(`Host("localhost") && Path("/users")`, "dup"))
+	s.Equal([]LintIssue{
+		{Kind: DuplicateLeaf, Expr: `Host("localhost") && Path("/users")`, Other: `Host("localhost") && Path("/users/?")`},
+	}, r.Lint())
+
+	// the escaped brackets are matched literally
+	s.Nil(r.AddRoute(`Path("/legacy\\[1\\]")`, "legacy"))
+	out, err := r.Route(makeReq(req{url: "/legacy[1]"}))
+	s.Nil(err)
+	s.Equal("legacy", out)
+	out, err = r.Route(makeReq(req{url: "/legacy"}))
+	s.Nil(err)
+	s.Nil(out)
+}
+
+func (s *RouteSuite) TestMergedTrieMatchesBestRoute() {
+	r := New()
+	s.Nil(r.AddRoute(`Host("h") && Method("GET") && Path("/x")`, "x"))
+	s.Nil(r.AddRoute(`Host("<s>") && Method("GET") && Path("/y")`, "y"))
+	s.Nil(r.AddRoute(`Host("h") && Method("GET")`, "get"))
+	// <x> and <string:x> share the trie node, and <t> goes in between them in the match order
+	s.Nil(r.AddRoute(`Path("/a/<x>/zz")`, "zz"))
+	s.Nil(r.AddRoute(`Path("/a/<t>/c")`, "t"))
+	s.Nil(r.AddRoute(`Path("/a/<string:x>/c")`, "x"))
+
+	tc := []struct {
+		url, host string
+		expected  string
+	}{
+		{url: "/y", host: "h", expected: "y"},
+		{url: "/x", host: "h", expected: "x"},
+		{url: "/z", host: "h", expected: "get"},
+		// the first branch of the trie has a worse route matching the request
+		{url: "/a/b/c", expected: "t"},
+	}
+	for _, t := range tc {
+		rq := makeReq(req{url: t.url, host: t.host, method: "GET"})
+		out, err := r.Route(rq)
+		s.Nil(err)
+		s.Equal(t.expected, out, t.url)
+		s.Equal(t.expected, r.RouteAll(rq)[0].Value, t.url)
+	}
+
+	routes := r.Routes()
+	s.Equal(`Host("<s>") && Method("GET") && Path("/y")`, routes[1].Expr)
+	s.Equal(`Host("h") && Method("GET")`, routes[2].Expr)
+	s.True(routes[2].Merged)
+}
+
+func (s *RouteSuite) TestIncrementalCompilation() {
+	exprs := []string{
+		`Path("/a")`,
+		`Path("/a/<int:id>")`,
+		`Path("/a/b") || Path("/c")`,
+		`PathRegexp("/a.*")`,
+		`Host("h1") && Path("/a")`,
+		`Host("h1") && Path("/a/<string:name>")`,
+		`Host("h1") && Method("GET")`,
+		`Host("h1")`,
+		`Host("h2") && Path("/a") && Method("GET")`,
+		`Host("h2") && Path("/a")`,
+		`Method("GET")`,
+		`Method("POST") && Path("/a")`,
+		`Priority(2) && Path("/b")`,
+		`Priority(2) && Path("/a/b")`,
+		`HostRegexp("h.*") && Path("/a")`,
+		`!Path("/c")`,
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	r := newTypedRouter[interface{}]()
+	for i := 0; i < 2000; i++ {
+		expr := exprs[rnd.Intn(len(exprs))]
+		switch rnd.Intn(3) {
+		case 0:
+			s.Nil(r.UpsertRoute(expr, i))
+		case 1:
+			s.Nil(r.RemoveRoute(expr))
+		default:
+			if _, ok := r.GetRoute(expr); !ok {
+				s.Nil(r.AddRoute(expr, i))
+			}
+		}
+
+		var alts []*match
+		r.compiled.Load().routes.each(func(_ string, route *parsedRoute) {
+			alts = append(alts, route.alternatives...)
+		})
+		sort.Slice(alts, func(i, j int) bool {
+			return alts[i].less(alts[j])
+		})
+		expected, err := compile(alts)
+		s.Require().NoError(err)
+		s.Require().Equal(printGroups(expected), printGroups(r.compiled.Load().groups), "after %d updates", i)
+	}
+}
+
+func BenchmarkUpsertRoute(b *testing.B) {
+	r := New()
+	routes := make(map[string]interface{})
+	for i := 0; i < 20000; i++ {
+		routes[fmt.Sprintf(`Host("h%d.example.com") && Path("/v%d/<string:name>")`, i%100, i)] = i
+	}
+	require.NoError(b, r.InitRoutes(routes))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		require.NoError(b, r.UpsertRoute(`Host("h1.example.com") && Path("/v1/<string:name>")`, i))
+	}
+}
+
+func printGroups(groups []*group) string {
+	var b strings.Builder
+	for _, g := range groups {
+		fmt.Fprintf(&b, "%s/%d..%s/%d: ", g.first.expr, g.first.alt, g.last.expr, g.last.alt)
+		for _, m := range g.routes() {
+			fmt.Fprintf(&b, "%s/%d ", m.expr, m.alt)
+		}
+		if t, ok := g.matcher.(*trie); ok {
+			fmt.Fprintf(&b, "%T%s", t.mapper, printTrie(t))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
 func (s *RouteSuite) TestGithubAPI() {
 	r := New()
 
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 )
@@ -50,13 +53,18 @@ func (t *trie) chain(o matcher) (matcher, error) {
 		return nil, fmt.Errorf("can chain only with other trie")
 	}
 
-	m := t.root.findMatchNode()
+	// Chain the copies, as the same tries can be chained to several alternatives, e.g. in (A || B) && C
+	root := t.root.clone()
+	m := root.findMatchNode()
 	m.matches = nil
-	m.children = []*trieNode{to.root}
-	t.root.setLevel(-1)
+	m.children = []*trieNode{to.root.clone()}
+	root.setLevel(-1)
+	if n := root.findMatchNode(); n != nil {
+		root.setFirst(n.matches[0])
+	}
 
 	return &trie{
-		root:   t.root,
+		root:   root,
 		mapper: newSeqMapper(t.mapper, to.mapper),
 	}, nil
 }
@@ -75,9 +83,8 @@ func (t *trie) canMerge(m matcher) bool {
 	return ok && t.mapper.equivalent(ot.mapper) != nil
 }
 
-// Merge takes the other trie and modifies itself to match the passed trie as well.
-// Note that trie passed as a parameter can be only simple trie without multiple branches per node, e.g. a->b->c->
-// Trie on the left is "accumulating" trie that grows.
+// Merge returns the trie matching the routes of both tries, neither of the tries is modified.
+// Trie on the left is usually "accumulating" trie that grows.
 func (t *trie) merge(m matcher) (matcher, error) {
 	other, ok := m.(*trie)
 	if !ok {
@@ -96,14 +103,76 @@ func (t *trie) merge(m matcher) (matcher, error) {
 	return &trie{root: root, mapper: mapper}, nil
 }
 
+// remove returns the trie without the route of the other trie merged into this trie before,
+// the other trie has to be a simple trie matching a single route.
+func (t *trie) remove(m matcher) (*trie, error) {
+	other, ok := m.(*trie)
+	if !ok {
+		return nil, fmt.Errorf("can't remove %T from %T", m, t)
+	}
+	n := other.root.findMatchNode()
+	if n == nil {
+		return nil, fmt.Errorf("trie has no route to remove")
+	}
+	return &trie{root: t.root.remove(other.root, n.matches[0]), mapper: t.mapper}, nil
+}
+
 // Takes the request and returns the location if the request path matches any of its paths
 // returns nil if none of the requests matches
-func (t *trie) match(r *http.Request) *match {
+func (t *trie) match(r *http.Request, st *matchState) *match {
 	if t.root == nil {
 		return nil
 	}
 
-	return t.root.match(t.mapper.newIter(r))
+	step := -1
+	if st.tracing() {
+		step = st.begin(TraceStep{Matcher: "trie", Mapper: t.mapper.String(), Input: traceInput(t.mapper, r)})
+	}
+
+	i := t.mapper.newIter(r)
+	i.capturing = st != nil
+	i.tracing = st.tracing()
+	search := &trieSearch{}
+	t.root.match(i, search)
+	result := search.best
+	if result != nil && st != nil {
+		for k, p := range search.params {
+			if _, ok := levelMapper(t.mapper, search.levels[k]).(*pathMapper); ok && strings.ContainsRune(p.Value, '%') {
+				st.escaped = append(st.escaped, len(st.params)+k)
+			}
+		}
+		st.params = append(st.params, search.params...)
+	}
+	if i.tracing {
+		st.trace.Steps[step].Walk = i.walk
+	}
+	st.end(step, result)
+	return result
+}
+
+// matchAll calls the function for every route of the trie matching the request in the order of the routes,
+// along with the values captured for the route
+func (t *trie) matchAll(r *http.Request, fn func(*match, Params)) {
+	if t.root == nil {
+		return
+	}
+	i := t.mapper.newIter(r)
+	i.capturing = true
+
+	type result struct {
+		m      *match
+		params Params
+	}
+	var results []result
+	t.root.matchAll(i, func(m *match, params Params) {
+		results = append(results, result{m: m, params: params})
+	})
+	sort.SliceStable(results, func(a, b int) bool {
+		return results[a].m.less(results[b].m)
+	})
+	for _, r := range results {
+		fn(r.m, r.params)
+	}
 }
 
 type trieNode struct {
@@ -119,11 +188,25 @@ type trieNode struct {
 	matches []*match
 	// For chained tries matching different parts of the request levels would increase for next chained trie nodes
 	level int
+	// first is the best route matched by this node or its children, see match.less
+	first *match
 }
 
 func (t *trieNode) setMatch(m *match) {
 	n := t.findMatchNode()
 	n.matches = []*match{m}
+	t.setFirst(m)
+}
+
+// clone returns the deep copy of the node and its children
+func (t *trieNode) clone() *trieNode {
+	out := *t
+	out.matches = append([]*match(nil), t.matches...)
+	out.children = make([]*trieNode, len(t.children))
+	for i, c := range t.children {
+		out.children[i] = c.clone()
+	}
+	return &out
 }
 
 func (t *trieNode) setLevel(level int) {
@@ -196,50 +279,122 @@ func (t *trieNode) equals(o *trieNode) bool {
 		((t.patternMatcher != nil && o.patternMatcher != nil) && t.patternMatcher.equals(o.patternMatcher)) // both nodes have equal matchers
 }
 
+// merge returns the node matching the routes of both nodes, the nodes are not modified and
+// the unchanged subtries are shared. The children are ordered by the best route they lead to,
+// so the merged trie does not depend on the order the routes were merged in.
 func (t *trieNode) merge(o *trieNode) (*trieNode, error) {
-	children := make([]*trieNode, 0, len(t.children))
-	merged := make(map[*trieNode]bool)
+	out := t.copy()
+	for _, c2 := range o.children {
+		i := out.indexOf(c2)
+		if i == -1 {
+			out.insertChild(c2)
+			continue
+		}
+		m, err := out.children[i].merge(c2)
+		if err != nil {
+			return nil, err
+		}
+		out.removeChild(i)
+		out.insertChild(m)
+	}
+	for _, m := range o.matches {
+		out.insertMatch(m)
+	}
+	out.updateFirst()
+	return out, nil
+}
 
-	// First, find the nodes with similar keys and merge them
-	for _, c := range t.children {
-		for _, c2 := range o.children {
-			// The nodes are equivalent, so we can merge them
-			if c.equals(c2) {
-				m, err := c.merge(c2)
-				if err != nil {
-					return nil, err
-				}
-				merged[c] = true
-				merged[c2] = true
-				children = append(children, m)
-			}
+// remove returns the node without the route, following the path of the route's own trie o.
+// Returns nil if the node has no routes left. Like merge, it does not modify the nodes.
+func (t *trieNode) remove(o *trieNode, m *match) *trieNode {
+	out := t.copy()
+	out.matches = slices.DeleteFunc(out.matches, func(x *match) bool { return x == m })
+	for _, c2 := range o.children {
+		i := out.indexOf(c2)
+		if i == -1 {
+			continue
 		}
+		c := out.children[i].remove(c2, m)
+		out.removeChild(i)
+		if c != nil {
+			out.insertChild(c)
+		}
+	}
+	if len(out.matches) == 0 && len(out.children) == 0 {
+		return nil
 	}
+	out.updateFirst()
+	return out
+}
 
-	// Next, append the keys that haven't been merged
+// allMatches appends the matches of the node and its children to out
+func (t *trieNode) allMatches(out []*match) []*match {
+	out = append(out, t.matches...)
 	for _, c := range t.children {
-		if !merged[c] {
-			children = append(children, c)
-		}
+		out = c.allMatches(out)
 	}
+	return out
+}
 
-	for _, c := range o.children {
-		if !merged[c] {
-			children = append(children, c)
+// copy returns the shallow copy of the node that can be modified without affecting the original
+func (t *trieNode) copy() *trieNode {
+	out := *t
+	out.children = append([]*trieNode(nil), t.children...)
+	out.matches = append([]*match(nil), t.matches...)
+	return &out
+}
+
+func (t *trieNode) indexOf(o *trieNode) int {
+	for i, c := range t.children {
+		if c.equals(o) {
+			return i
 		}
 	}
+	return -1
+}
 
-	return &trieNode{
-		level:          t.level,
-		trie:           t.trie,
-		char:           t.char,
-		children:       children,
-		patternMatcher: t.patternMatcher,
-		matches:        append(t.matches, o.matches...),
-	}, nil
+// insertChild inserts the child keeping the children ordered by the best route,
+// the child goes after the children leading to the equal routes
+func (t *trieNode) insertChild(c *trieNode) {
+	i := sort.Search(len(t.children), func(i int) bool {
+		return c.first.less(t.children[i].first)
+	})
+	t.children = slices.Insert(t.children, i, c)
+}
+
+func (t *trieNode) removeChild(i int) {
+	t.children = slices.Delete(t.children, i, i+1)
+}
+
+func (t *trieNode) insertMatch(m *match) {
+	i := sort.Search(len(t.matches), func(i int) bool {
+		return m.less(t.matches[i])
+	})
+	t.matches = slices.Insert(t.matches, i, m)
+}
+
+// updateFirst updates the best route of the node, the children and matches are ordered
+func (t *trieNode) updateFirst() {
+	t.first = nil
+	if len(t.matches) != 0 {
+		t.first = t.matches[0]
+	}
+	if len(t.children) != 0 && (t.first == nil || t.children[0].first.less(t.first)) {
+		t.first = t.children[0].first
+	}
+}
+
+// setFirst sets the best route of the node and its children, used for the tries
+// matching a single route, where it's the only route
+func (t *trieNode) setFirst(m *match) {
+	t.first = m
+	for _, c := range t.children {
+		c.setFirst(m)
+	}
 }
 
 func (t *trieNode) parseExpression(offset int, pattern string, m *match) error {
+	t.first = m
 	// We are the last element, so we are the matching node
 	if offset >= len(pattern)-1 {
 		t.matches = []*match{m}
@@ -304,16 +459,24 @@ type patternMatcher interface {
 	String() string
 }
 
+// builtinMatchers are the factories of the built-in pattern matchers, see RegisterPatternMatcher for the others
+var builtinMatchers = map[string]func(args []string) (patternMatcher, error){
+	"string": newStringMatcher,
+	"path":   newPathMatcher,
+	"int":    newIntMatcher,
+	"uuid":   newSegmentMatcher("uuid", isUUID),
+	"hex":    newSegmentMatcher("hex", isHex),
+	"alpha":  newSegmentMatcher("alpha", isAlpha),
+	"float":  newSegmentMatcher("float", isFloat),
+	"enum":   newEnumMatcher,
+	"re":     newRePatternMatcher,
+}
+
 func makeMatcher(matcherType string, matcherArgs []string) (patternMatcher, error) {
-	switch matcherType {
-	case "string":
-		return newStringMatcher(matcherArgs)
-	case "path":
-		return newPathMatcher(matcherArgs)
-	case "int":
-		return newIntMatcher(matcherArgs)
+	if factory, ok := builtinMatchers[matcherType]; ok {
+		return factory(matcherArgs)
 	}
-	return nil, fmt.Errorf("unsupported matcher: %s", matcherType)
+	return makeRegisteredMatcher(matcherType, matcherArgs)
 }
 
 func newPathMatcher(args []string) (patternMatcher, error) {
@@ -347,7 +510,9 @@ func (m *pathMatcher) equals(other patternMatcher) bool {
 }
 
 func (m *pathMatcher) grabValue(i *charIter) {
-	for {
+	// stop at the end of the current string, the rest of the sequence belongs to chained tries
+	level := i.level()
+	for i.level() == level {
 		_, _, ok := i.next()
 		if !ok {
 			return
@@ -355,19 +520,54 @@ func (m *pathMatcher) grabValue(i *charIter) {
 	}
 }
 
+// newStringMatcher returns the string matcher, the optional constraints limit the length
+// of the matched string, e.g. <string:code:len=2> or <string:name:min=2:max=64>
 func newStringMatcher(args []string) (patternMatcher, error) {
-	if len(args) != 1 {
-		return nil, fmt.Errorf("expected only one parameter - variable name, got: %s", args)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("expected variable name, got: %s", args)
 	}
 
-	return &stringMatcher{name: args[0]}, nil
+	m := &stringMatcher{name: args[0], max: -1}
+	for _, arg := range args[1:] {
+		key, val, _ := strings.Cut(arg, "=")
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("unsupported string constraint '%s', expected len=N, min=N or max=N", arg)
+		}
+		switch key {
+		case "len":
+			m.min, m.max = n, n
+		case "min":
+			m.min = n
+		case "max":
+			m.max = n
+		default:
+			return nil, fmt.Errorf("unsupported string constraint '%s', expected len=N, min=N or max=N", arg)
+		}
+	}
+	if m.max >= 0 && m.min > m.max {
+		return nil, fmt.Errorf("string constraints %s can't be satisfied", args[1:])
+	}
+	return m, nil
 }
 
 type stringMatcher struct {
 	name string
+	// min and max limit the length of the matched string, max is negative if there's no limit
+	min, max int
 }
 
 func (s *stringMatcher) String() string {
+	switch {
+	case s.min == s.max:
+		return fmt.Sprintf("<string:%s:len=%d>", s.name, s.min)
+	case s.min > 0 && s.max >= 0:
+		return fmt.Sprintf("<string:%s:min=%d:max=%d>", s.name, s.min, s.max)
+	case s.min > 0:
+		return fmt.Sprintf("<string:%s:min=%d>", s.name, s.min)
+	case s.max >= 0:
+		return fmt.Sprintf("<string:%s:max=%d>", s.name, s.max)
+	}
 	return fmt.Sprintf("<string:%s>", s.name)
 }
 
@@ -376,17 +576,32 @@ func (s *stringMatcher) getName() string {
 }
 
 func (s *stringMatcher) match(i *charIter) bool {
+	if s.min == 0 && s.max < 0 {
+		s.grabValue(i)
+		return true
+	}
+	p := i.position()
 	s.grabValue(i)
+	if n := len(i.slice(p, i.position())); n < s.min || (s.max >= 0 && n > s.max) {
+		i.setPosition(p)
+		return false
+	}
 	return true
 }
 
 func (s *stringMatcher) equals(other patternMatcher) bool {
-	_, ok := other.(*stringMatcher)
-	return ok && other.getName() == s.getName()
+	o, ok := other.(*stringMatcher)
+	return ok && o.name == s.name && o.min == s.min && o.max == s.max
 }
 
 func (s *stringMatcher) grabValue(i *charIter) {
-	for {
+	grabSegment(i)
+}
+
+// grabSegment consumes the characters up to the separator or the end of the current string
+func grabSegment(i *charIter) {
+	level := i.level()
+	for i.level() == level {
 		c, sep, ok := i.next()
 		if !ok {
 			return
@@ -398,19 +613,38 @@ func (s *stringMatcher) grabValue(i *charIter) {
 	}
 }
 
+// newIntMatcher returns the int matcher, the optional constraint limits the range
+// of the matched number, e.g. <int:page:1-500>
 func newIntMatcher(args []string) (patternMatcher, error) {
-	if len(args) != 1 {
-		return nil, fmt.Errorf("expected only one parameter - variable name, got: %s", args)
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("expected variable name and optional range, got: %s", args)
 	}
 
-	return &intMatcher{name: args[0]}, nil
+	m := &intMatcher{name: args[0]}
+	if len(args) == 2 {
+		from, to, _ := strings.Cut(args[1], "-")
+		var err1, err2 error
+		m.min, err1 = strconv.ParseUint(from, 10, 64)
+		m.max, err2 = strconv.ParseUint(to, 10, 64)
+		if err1 != nil || err2 != nil || m.min > m.max {
+			return nil, fmt.Errorf("unsupported int constraint '%s', expected range MIN-MAX", args[1])
+		}
+		m.ranged = true
+	}
+	return m, nil
 }
 
 type intMatcher struct {
 	name string
+	// min and max limit the matched number if the matcher is ranged
+	ranged   bool
+	min, max uint64
 }
 
 func (s *intMatcher) String() string {
+	if s.ranged {
+		return fmt.Sprintf("<int:%s:%d-%d>", s.name, s.min, s.max)
+	}
 	return fmt.Sprintf("<int:%s>", s.name)
 }
 
@@ -423,8 +657,14 @@ func (s *intMatcher) match(iter *charIter) bool {
 	// so we know how many push backs to do in case there is no match
 	var count int
 
-	for {
+	start := iter.position()
+	level := iter.level()
+	for iter.level() == level {
 		c, sep, ok := iter.next()
+		// if it's the end of the string, it's a match
+		if !ok {
+			break
+		}
 		count++
 
 		// if the current character is not a number:
@@ -433,25 +673,244 @@ func (s *intMatcher) match(iter *charIter) bool {
 		if !unicode.IsDigit(rune(c)) {
 			if c == sep {
 				iter.pushBack()
-				return true
-			} else {
-				for i := 0; i < count; i++ {
-					iter.pushBack()
-				}
+				count--
+				break
+			}
+			for i := 0; i < count; i++ {
+				iter.pushBack()
+			}
+			return false
+		}
+	}
+	// at least one digit is required
+	if count == 0 || !s.ranged {
+		return count > 0
+	}
+	// the numbers too big to parse are out of range as well
+	n, err := strconv.ParseUint(iter.slice(start, iter.position()), 10, 64)
+	if err != nil || n < s.min || n > s.max {
+		for i := 0; i < count; i++ {
+			iter.pushBack()
+		}
+		return false
+	}
+	return true
+}
+
+func (s *intMatcher) equals(other patternMatcher) bool {
+	o, ok := other.(*intMatcher)
+	return ok && o.name == s.name && o.ranged == s.ranged && o.min == s.min && o.max == s.max
+}
+
+// newSegmentMatcher returns the factory of the matchers checking the characters up to the separator
+func newSegmentMatcher(kind string, valid func(string) bool) func(args []string) (patternMatcher, error) {
+	return func(args []string) (patternMatcher, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected only one parameter - variable name, got: %s", args)
+		}
+		return &segmentMatcher{kind: kind, name: args[0], valid: valid}, nil
+	}
+}
+
+func newEnumMatcher(args []string) (patternMatcher, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("expected variable name and values separated by |, got: %s", args)
+	}
+	values := strings.Split(args[1], "|")
+	for _, v := range values {
+		if v == "" {
+			return nil, fmt.Errorf("enum values can't be empty, got: %s", args[1])
+		}
+	}
+	valid := func(s string) bool {
+		return slices.Contains(values, s)
+	}
+	return &segmentMatcher{kind: "enum", name: args[0], values: values, valid: valid}, nil
+}
+
+// segmentMatcher matches the characters up to the separator or the end of the string if they are valid,
+// e.g. <uuid:id> or <enum:format:json|xml>, otherwise it pushes back the characters consumed
+type segmentMatcher struct {
+	kind string
+	name string
+	// values are the values of enum
+	values []string
+	valid  func(string) bool
+}
+
+func (s *segmentMatcher) String() string {
+	if s.values != nil {
+		return fmt.Sprintf("<%s:%s:%s>", s.kind, s.name, strings.Join(s.values, "|"))
+	}
+	return fmt.Sprintf("<%s:%s>", s.kind, s.name)
+}
+
+func (s *segmentMatcher) getName() string {
+	return s.name
+}
+
+func (s *segmentMatcher) match(i *charIter) bool {
+	p := i.position()
+	grabSegment(i)
+	if !s.valid(i.slice(p, i.position())) {
+		i.setPosition(p)
+		return false
+	}
+	return true
+}
+
+func (s *segmentMatcher) equals(other patternMatcher) bool {
+	o, ok := other.(*segmentMatcher)
+	if !ok || o.kind != s.kind || o.name != s.name || len(o.values) != len(s.values) {
+		return false
+	}
+	// the enums of the same values in a different order match the same strings
+	for _, v := range s.values {
+		if !slices.Contains(o.values, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func newRePatternMatcher(args []string) (patternMatcher, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("expected variable name and regular expression, got: %s", args)
+	}
+	// the regular expression can contain the colons the arguments are split by
+	expr := strings.Join(args[1:], ":")
+	prefix, err := regexp.Compile("^(?:" + expr + ")")
+	if err != nil {
+		return nil, err
+	}
+	prefix.Longest()
+	return &rePatternMatcher{name: args[0], expr: expr, prefix: prefix, re: regexp.MustCompile("^(?:" + expr + ")$")}, nil
+}
+
+// maxReSegment limits the length of the segment matched by the regexp placeholders,
+// as the shorter matches are checked one by one
+const maxReSegment = 1024
+
+// rePatternMatcher matches the prefix of the segment up to the separator matching the regular expression,
+// e.g. <re:name:[a-z]+> matches abc of /abc.txt, so the pattern can go on with the characters after the placeholder.
+// The trie tries the matching prefixes, the longest first, until the rest of the pattern matches as well.
+// The segments longer than maxReSegment never match.
+type rePatternMatcher struct {
+	name string
+	expr string
+	// prefix finds the longest matching prefix, re checks the shorter ones
+	prefix *regexp.Regexp
+	re     *regexp.Regexp
+}
+
+func (r *rePatternMatcher) String() string {
+	return fmt.Sprintf("<re:%s:%s>", r.name, r.expr)
+}
+
+func (r *rePatternMatcher) getName() string {
+	return r.name
+}
+
+// match consumes the longest matching prefix, see trieNode.matchEach for the shorter ones
+func (r *rePatternMatcher) match(i *charIter) bool {
+	lengths := r.lengths(i, nil)
+	if len(lengths) == 0 {
+		return false
+	}
+	for n := 0; n < lengths[0]; n++ {
+		i.next()
+	}
+	return true
+}
+
+// lengths returns the lengths of the prefixes of the segment matching the regular expression,
+// the longest first, the iterator stays at the same position. The shorter prefixes are only checked
+// if they are followed by the character the stop function accepts, e.g. the one the pattern goes on with.
+func (r *rePatternMatcher) lengths(i *charIter, stop func(byte) bool) []int {
+	p := i.position()
+	grabSegment(i)
+	segment := i.slice(p, i.position())
+	i.setPosition(p)
+	if len(segment) > maxReSegment {
+		return nil
+	}
+
+	loc := r.prefix.FindStringIndex(segment)
+	if loc == nil {
+		return nil
+	}
+	out := []int{loc[1]}
+	if stop == nil {
+		return out
+	}
+	for n := loc[1] - 1; n >= 0; n-- {
+		if stop(segment[n]) && r.re.MatchString(segment[:n]) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func (r *rePatternMatcher) equals(other patternMatcher) bool {
+	o, ok := other.(*rePatternMatcher)
+	return ok && o.name == r.name && o.expr == r.expr
+}
+
+// isUUID returns true for the UUIDs in the canonical form, e.g. 123e4567-e89b-12d3-a456-426614174000
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if i == 8 || i == 13 || i == 18 || i == 23 {
+			if s[i] != '-' {
 				return false
 			}
+		} else if !isHexDigit(s[i]) {
+			return false
 		}
+	}
+	return true
+}
 
-		// if it's the end of the string, it's a match
-		if !ok {
-			return true
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isHexDigit(s[i]) {
+			return false
 		}
 	}
+	return len(s) > 0
 }
 
-func (s *intMatcher) equals(other patternMatcher) bool {
-	_, ok := other.(*intMatcher)
-	return ok && other.getName() == s.getName()
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isAlpha(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !((s[i] >= 'a' && s[i] <= 'z') || (s[i] >= 'A' && s[i] <= 'Z')) {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+// isFloat returns true for the decimal numbers with optional sign and fraction, e.g. -12.5
+func isFloat(s string) bool {
+	if len(s) > 0 && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+	whole, frac, dot := strings.Cut(s, ".")
+	return isDigits(whole) && (!dot || isDigits(frac))
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return len(s) > 0
 }
 
 func (t *trieNode) matchNode(i *charIter) bool {
@@ -464,7 +923,12 @@ func (t *trieNode) matchNode(i *charIter) bool {
 	}
 
 	if t.isPatternMatcher() {
-		return t.patternMatcher.match(i)
+		p := i.position()
+		if !t.patternMatcher.match(i) {
+			return false
+		}
+		i.capture(t.patternMatcher.getName(), p)
+		return true
 	}
 
 	c, _, ok := i.next()
@@ -482,31 +946,98 @@ func (t *trieNode) matchNode(i *charIter) bool {
 	return true
 }
 
-func (t *trieNode) match(i *charIter) *match {
-	if !t.matchNode(i) {
-		return nil
-	}
+// trieSearch is the best route found while walking the trie and the values captured for it
+type trieSearch struct {
+	best   *match
+	params Params
+	levels []int
+}
 
-	// This is a leaf node, and we are at the last character of the pattern
-	if len(t.matches) != 0 && i.isEnd() {
-		return t.matches[0]
+// found records the route if it goes before the best route found so far
+func (s *trieSearch) found(m *match, i *charIter) {
+	if s.best != nil && !m.less(s.best) {
+		return
 	}
+	s.best = m
+	s.params = append(s.params[:0], i.params...)
+	s.levels = append(s.levels[:0], i.levels...)
+}
 
-	// Check for the match in child nodes
-	for _, c := range t.children {
-		p := i.position()
-		if match := c.match(i); match != nil {
-			return match
+// match looks for the best route of the node subtree matching the request, see match.less.
+// The merged tries may have the routes checking less conditions in the leaves reached first,
+// so the walk goes on while the subtrees have the routes going before the best route found.
+func (t *trieNode) match(i *charIter, s *trieSearch) {
+	t.matchEach(i, func() {
+		if i.tracing {
+			i.walk = append(i.walk, t.String())
 		}
 
-		i.setPosition(p)
-	}
-	// Child nodes did not match and we at the boundary
-	if len(t.matches) != 0 && i.level() > t.level {
-		return t.matches[0]
+		// This is a leaf node, and we are either at the last character of the pattern or at the boundary
+		if len(t.matches) != 0 && (i.isEnd() || i.level() > t.level) {
+			s.found(t.matches[0], i)
+		}
+
+		// Check for the better match in child nodes, they are ordered by their best routes
+		for _, c := range t.children {
+			if s.best != nil && !c.first.less(s.best) {
+				return
+			}
+			p := i.position()
+			c.match(i, s)
+			i.setPosition(p)
+		}
+	})
+}
+
+// matchAll works like match, but walks all the branches of the node calling the function for every match found
+func (t *trieNode) matchAll(i *charIter, fn func(*match, Params)) {
+	t.matchEach(i, func() {
+		// This is a leaf node, and we are either at the last character of the pattern or at the boundary
+		if len(t.matches) != 0 && (i.isEnd() || i.level() > t.level) {
+			for _, m := range t.matches {
+				fn(m, append(Params(nil), i.params...))
+			}
+		}
+
+		for _, c := range t.children {
+			p := i.position()
+			c.matchAll(i, fn)
+			i.setPosition(p)
+		}
+	})
+}
+
+// matchEach calls the function for every way the node matches the characters of the iterator,
+// with the iterator right after the matched characters. The regexp placeholders match
+// several prefixes of the segment, so the walk backtracks to the shorter ones if the rest does not match.
+func (t *trieNode) matchEach(i *charIter, fn func()) {
+	re, ok := t.patternMatcher.(*rePatternMatcher)
+	if !ok || i.level() != t.level {
+		if t.matchNode(i) {
+			fn()
+		}
+		return
 	}
 
-	return nil
+	// the shorter matches are only worth trying where the children can go on
+	stop := func(c byte) bool {
+		for _, child := range t.children {
+			if child.isPatternMatcher() || child.char == c {
+				return true
+			}
+		}
+		return false
+	}
+	p := i.position()
+	for _, n := range re.lengths(i, stop) {
+		i.setPosition(p)
+		for k := 0; k < n; k++ {
+			i.next()
+		}
+		i.capture(re.name, p)
+		fn()
+	}
+	i.setPosition(p)
 }
 
 // printTrie is useful for debugging and test purposes,
@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -24,7 +25,7 @@ func TestTrieSuite(t *testing.T) {
 
 func (s *TrieSuite) TestParseTrieSuccess() {
 	m, r := makeTrie(s.T(), "/", &pathMapper{}, "val")
-	s.Equal(r, m.match(makeReq(req{url: "http://google.com"})))
+	s.Equal(r, m.match(makeReq(req{url: "http://google.com"}), nil))
 }
 
 func (s *TrieSuite) TestParseTrieFailures() {
@@ -117,8 +118,8 @@ root(0)
 `
 	s.Equal(expected, printTrie(t3.(*trie)))
 
-	s.Equal(l1, t3.match(makeReq(req{url: "http://google.com/a"})))
-	s.Equal(l2, t3.match(makeReq(req{url: "http://google.com/b"})))
+	s.Equal(l1, t3.match(makeReq(req{url: "http://google.com/a"}), nil))
+	s.Equal(l2, t3.match(makeReq(req{url: "http://google.com/b"}), nil))
 }
 
 func (s *TrieSuite) TestMergeTriesSubtree() {
@@ -136,9 +137,70 @@ root(0)
 `
 	s.Equal(printTrie(t3.(*trie)), expected)
 
-	s.Equal(l1, t3.match(makeReq(req{url: "http://google.com/aa"})))
-	s.Equal(l2, t3.match(makeReq(req{url: "http://google.com/a"})))
-	s.Nil(t3.match(makeReq(req{url: "http://google.com/b"})))
+	s.Equal(l1, t3.match(makeReq(req{url: "http://google.com/aa"}), nil))
+	s.Equal(l2, t3.match(makeReq(req{url: "http://google.com/a"}), nil))
+	s.Nil(t3.match(makeReq(req{url: "http://google.com/b"}), nil))
+}
+
+func (s *TrieSuite) TestMergeOrderDoesNotMatter() {
+	t1, l1 := makeTrie(s.T(), "/a/<string:name>", &pathMapper{}, "v1")
+	t2, l2 := makeTrie(s.T(), "/a/b", &pathMapper{}, "v2")
+	l1.expr, l2.expr = "b", "a"
+
+	m1, err := t1.merge(t2)
+	s.Require().NoError(err)
+	m2, err := t2.merge(t1)
+	s.Require().NoError(err)
+
+	expected := `
+root(0)
+ node(0:/)
+  node(0:a)
+   node(0:/)
+    match(0:<string:name>)
+    match(0:b)
+`
+	s.Equal(expected, printTrie(m1.(*trie)))
+	s.Equal(expected, printTrie(m2.(*trie)))
+
+	// the better route is matched first regardless of the merge order
+	s.Equal(l1, m1.match(makeReq(req{url: "http://google.com/a/b"}), nil))
+	s.Equal(l1, m2.match(makeReq(req{url: "http://google.com/a/b"}), nil))
+}
+
+func (s *TrieSuite) TestRemoveFromMergedTrie() {
+	t1, l1 := makeTrie(s.T(), "/a/b", &pathMapper{}, "v1")
+	t2, l2 := makeTrie(s.T(), "/a", &pathMapper{}, "v2")
+	t3, _ := makeTrie(s.T(), "/a/c", &pathMapper{}, "v3")
+
+	m, err := t1.merge(t2)
+	s.Require().NoError(err)
+	m, err = m.merge(t3)
+	s.Require().NoError(err)
+
+	out, err := m.(*trie).remove(t3)
+	s.Require().NoError(err)
+	expected := `
+root(0)
+ node(0:/)
+  match(0:a)
+   node(0:/)
+    match(0:b)
+`
+	s.Equal(expected, printTrie(out))
+	s.Equal(l1, out.match(makeReq(req{url: "http://google.com/a/b"}), nil))
+	s.Equal(l2, out.match(makeReq(req{url: "http://google.com/a"}), nil))
+	s.Nil(out.match(makeReq(req{url: "http://google.com/a/c"}), nil))
+
+	// the merged trie has not changed
+	s.NotNil(m.match(makeReq(req{url: "http://google.com/a/c"}), nil))
+
+	out, err = out.remove(t2)
+	s.Require().NoError(err)
+	out, err = out.remove(t1)
+	s.Require().NoError(err)
+	s.Nil(out.root)
+	s.Nil(out.match(makeReq(req{url: "http://google.com/a"}), nil))
 }
 
 func (s *TrieSuite) TestMergeTriesWithCommonParameter() {
@@ -160,9 +222,9 @@ root(0)
 `
 	s.Equal(printTrie(t3.(*trie)), expected)
 
-	s.Equal(t3.match(makeReq(req{url: "http://google.com/a/bla/b"})), l1)
-	s.Equal(t3.match(makeReq(req{url: "http://google.com/a/bla/c"})), l2)
-	s.Nil(t3.match(makeReq(req{url: "http://google.com/a/"})))
+	s.Equal(t3.match(makeReq(req{url: "http://google.com/a/bla/b"}), nil), l1)
+	s.Equal(t3.match(makeReq(req{url: "http://google.com/a/bla/c"}), nil), l2)
+	s.Nil(t3.match(makeReq(req{url: "http://google.com/a/"}), nil))
 }
 
 func (s *TrieSuite) TestMergeTriesWithDivergedParameter() {
@@ -186,9 +248,9 @@ root(0)
 `
 	s.Equal(printTrie(t3.(*trie)), expected)
 
-	s.Equal(l1, t3.match(makeReq(req{url: "http://google.com/a/bla/b"})))
-	s.Equal(l2, t3.match(makeReq(req{url: "http://google.com/a/bla/c"})))
-	s.Nil(t3.match(makeReq(req{url: "http://google.com/a/"})))
+	s.Equal(l1, t3.match(makeReq(req{url: "http://google.com/a/bla/b"}), nil))
+	s.Equal(l2, t3.match(makeReq(req{url: "http://google.com/a/bla/c"}), nil))
+	s.Nil(t3.match(makeReq(req{url: "http://google.com/a/"}), nil))
 }
 
 func (s *TrieSuite) TestMergeTriesWithSamePath() {
@@ -205,7 +267,7 @@ root(0)
 `
 	s.Equal(expected, printTrie(t3.(*trie)))
 	// The first location will match as it will always go first
-	s.Equal(l1, t3.match(makeReq(req{url: "http://google.com/a"})))
+	s.Equal(l1, t3.match(makeReq(req{url: "http://google.com/a"}), nil))
 }
 
 func (s *TrieSuite) TestMergeAndMatchCases() {
@@ -274,7 +336,7 @@ func (s *TrieSuite) TestMergeAndMatchCases() {
 			s.Require().NoError(err)
 			t = out.(*trie)
 		}
-		out := t.match(makeReq(req{url: tc.url}))
+		out := t.match(makeReq(req{url: tc.url}), nil)
 		s.Equal(tc.expected, out.val)
 	}
 }
@@ -318,12 +380,333 @@ func (s *TrieSuite) TestChainAndMatchCases() {
 			s.Require().NoError(err)
 			out = m.(*trie)
 		}
-		result := out.match(tc.req)
+		result := out.match(tc.req, nil)
 		s.NotNil(result, comment)
 		s.Equal(tc.expected, result.val, comment)
 	}
 }
 
+func (s *TrieSuite) TestCaptureParams() {
+	t1, l1 := makeTrie(s.T(), "/v<int:version>/domains/<string:name>", &pathMapper{}, "v1")
+	t2, l2 := makeTrie(s.T(), "/<string:version>/domains/<string:name>/<path:rest>", &pathMapper{}, "v2")
+	out, err := t1.merge(t2)
+	s.Require().NoError(err)
+
+	st := &matchState{}
+	s.Equal(l1, out.match(makeReq(req{url: "http://google.com/v42/domains/d1"}), st))
+	s.Equal(Params{{Name: "version", Value: "42"}, {Name: "name", Value: "d1"}}, st.params)
+
+	// parameters captured by the branches that did not match are dropped
+	st = &matchState{}
+	s.Equal(l2, out.match(makeReq(req{url: "http://google.com/v42/domains/d1/a/b"}), st))
+	s.Equal(Params{{Name: "version", Value: "v42"}, {Name: "name", Value: "d1"}, {Name: "rest", Value: "a/b"}}, st.params)
+
+	st = &matchState{}
+	s.Nil(out.match(makeReq(req{url: "http://google.com/v42"}), st))
+	s.Empty(st.params)
+}
+
+func (s *TrieSuite) TestPatternsStopAtChainBoundary() {
+	tries := []*trie{
+		newTrie(s.T(), "h.<tld>", &hostMapper{}, "v"),
+		newTrie(s.T(), "<int:method>", &methodMapper{}, "v"),
+		newTrie(s.T(), "/<path:rest>", &pathMapper{}, "v"),
+	}
+	out := tries[0]
+	for _, t := range tries[1:] {
+		m, err := out.chain(t)
+		s.Require().NoError(err)
+		out = m.(*trie)
+	}
+
+	st := &matchState{}
+	result := out.match(makeReq(req{url: "http://h.com/a/b", method: "42", host: "h.com"}), st)
+	s.Require().NotNil(result)
+	s.Equal(Params{{Name: "tld", Value: "com"}, {Name: "method", Value: "42"}, {Name: "rest", Value: "a/b"}}, st.params)
+
+	s.Nil(out.match(makeReq(req{url: "http://h.com/a/b", method: "GET", host: "h.com"}), nil))
+}
+
+func (s *TrieSuite) TestIntMatcherAtTheEnd() {
+	t, l := makeTrie(s.T(), "/v<int:version>", &pathMapper{}, "v")
+	s.Equal(l, t.match(makeReq(req{url: "http://google.com/v42"}), nil))
+	s.Nil(t.match(makeReq(req{url: "http://google.com/v"}), nil))
+	s.Nil(t.match(makeReq(req{url: "http://google.com/v4a"}), nil))
+}
+
+func (s *TrieSuite) TestBuiltinPatternMatchers() {
+	tc := []struct {
+		pattern string
+		url     string
+		params  Params
+	}{
+		{pattern: "/users/<uuid:id>", url: "/users/123e4567-E89B-12d3-a456-426614174000", params: Params{{Name: "id", Value: "123e4567-E89B-12d3-a456-426614174000"}}},
+		{pattern: "/users/<uuid:id>", url: "/users/123e4567-e89b-12d3-a456-42661417400"},
+		{pattern: "/users/<uuid:id>", url: "/users/123e4567e-89b-12d3-a456-426614174000"},
+		{pattern: "/users/<uuid:id>", url: "/users/123e4567-e89b-12d3-a456-42661417400g"},
+		{pattern: "/commits/<hex:sha>/files", url: "/commits/DEADbeef01/files", params: Params{{Name: "sha", Value: "DEADbeef01"}}},
+		{pattern: "/commits/<hex:sha>/files", url: "/commits/deadbeefg/files"},
+		{pattern: "/commits/<hex:sha>/files", url: "/commits//files"},
+		{pattern: "/tags/<alpha:slug>", url: "/tags/Golang", params: Params{{Name: "slug", Value: "Golang"}}},
+		{pattern: "/tags/<alpha:slug>", url: "/tags/go1"},
+		{pattern: "/geo/<float:lat>/<float:lng>", url: "/geo/-12.5/40", params: Params{{Name: "lat", Value: "-12.5"}, {Name: "lng", Value: "40"}}},
+		{pattern: "/geo/<float:lat>/<float:lng>", url: "/geo/12./40"},
+		{pattern: "/geo/<float:lat>/<float:lng>", url: "/geo/.5/40"},
+		{pattern: "/geo/<float:lat>/<float:lng>", url: "/geo/1e5/40"},
+		{pattern: "/report.<enum:fmt:json|xml|csv>", url: "/report.xml", params: Params{{Name: "fmt", Value: "xml"}}},
+		{pattern: "/report.<enum:fmt:json|xml|csv>", url: "/report.jsonp"},
+		{pattern: "/report.<enum:fmt:json|xml|csv>", url: "/report.js"},
+	}
+	for _, t := range tc {
+		tr, l := makeTrie(s.T(), t.pattern, &pathMapper{}, "v")
+		st := &matchState{}
+		out := tr.match(makeReq(req{url: t.url}), st)
+		if t.params == nil {
+			s.Nil(out, t.url)
+			continue
+		}
+		s.Equal(l, out, t.url)
+		s.Equal(t.params, st.params, t.url)
+	}
+
+	for _, p := range []string{"/<enum:fmt>", "/<enum:fmt:json||xml>", "/<hex:a:b>"} {
+		_, err := newTrieMatcher(p, &pathMapper{}, &match{})
+		s.Error(err, p)
+	}
+}
+
+func (s *TrieSuite) TestBuiltinPatternMatchersBacktrack() {
+	out, leaves := mergeTries(s.T(),
+		"/files/<hex:sha>",
+		"/files/<uuid:id>",
+		"/files/<float:size>",
+		"/files/<enum:name:readme|license>",
+		"/files/<alpha:name>/raw",
+		"/files/<string:name>",
+	)
+
+	tc := []struct {
+		url    string
+		expr   string
+		params Params
+	}{
+		{url: "/files/abc", expr: "/files/<hex:sha>", params: Params{{Name: "sha", Value: "abc"}}},
+		{url: "/files/123e4567-e89b-12d3-a456-426614174000", expr: "/files/<uuid:id>", params: Params{{Name: "id", Value: "123e4567-e89b-12d3-a456-426614174000"}}},
+		{url: "/files/1.5", expr: "/files/<float:size>", params: Params{{Name: "size", Value: "1.5"}}},
+		{url: "/files/readme", expr: "/files/<enum:name:readme|license>", params: Params{{Name: "name", Value: "readme"}}},
+		{url: "/files/doc/raw", expr: "/files/<alpha:name>/raw", params: Params{{Name: "name", Value: "doc"}}},
+		{url: "/files/doc", expr: "/files/<string:name>", params: Params{{Name: "name", Value: "doc"}}},
+		{url: "/files/doc2/raw"},
+	}
+	for _, t := range tc {
+		st := &matchState{}
+		l := out.match(makeReq(req{url: t.url}), st)
+		if t.expr == "" {
+			s.Nil(l, t.url)
+			continue
+		}
+		s.Equal(leaves[t.expr], l, t.url)
+		s.Equal(t.params, st.params, t.url)
+	}
+
+	// the equal matchers share the trie node
+	t1 := newTrie(s.T(), "/<enum:f:json|xml>/a", &pathMapper{}, "a")
+	t2 := newTrie(s.T(), "/<enum:f:xml|json>/b", &pathMapper{}, "b")
+	t3 := newTrie(s.T(), "/<enum:f:json>/c", &pathMapper{}, "c")
+	m, err := t1.merge(t2)
+	s.Require().NoError(err)
+	m, err = m.merge(t3)
+	s.Require().NoError(err)
+	s.Len(m.(*trie).root.children[0].children, 2)
+}
+
+func (s *TrieSuite) TestRePatternMatcher() {
+	t1, l1 := makeTrie(s.T(), "/files/<re:name:[a-z0-9_-]{1,16}>.txt", &pathMapper{}, "txt")
+	t2, l2 := makeTrie(s.T(), "/files/<re:name:[a-z0-9_-]{1,16}>/raw", &pathMapper{}, "raw")
+	t3, l3 := makeTrie(s.T(), "/at/<re:time:[0-9]{2}:[0-9]{2}>", &pathMapper{}, "at")
+	out, err := t1.merge(t2)
+	s.Require().NoError(err)
+	out, err = out.merge(t3)
+	s.Require().NoError(err)
+	// the placeholders with the same regexp share the trie node
+	s.Len(out.(*trie).root.children[0].children[0].children, 1)
+
+	tc := []struct {
+		url    string
+		leaf   *match
+		params Params
+	}{
+		{url: "/files/my-file_1.txt", leaf: l1, params: Params{{Name: "name", Value: "my-file_1"}}},
+		{url: "/files/abc/raw", leaf: l2, params: Params{{Name: "name", Value: "abc"}}},
+		{url: "/at/12:30", leaf: l3, params: Params{{Name: "time", Value: "12:30"}}},
+		{url: "/files/My.txt"},
+		{url: "/files/averyveryverylongname.txt"},
+		{url: "/files/.txt"},
+		{url: "/files/a/b.txt"},
+		{url: "/at/12:3"},
+	}
+	for _, t := range tc {
+		st := &matchState{}
+		l := out.match(makeReq(req{url: t.url}), st)
+		if t.leaf == nil {
+			s.Nil(l, t.url)
+			continue
+		}
+		s.Equal(t.leaf, l, t.url)
+		s.Equal(t.params, st.params, t.url)
+	}
+
+	// the route stays in the trie merged with the other routes
+	r := New()
+	s.Require().NoError(r.AddRoute(`Path("/files/<re:name:[a-z0-9_-]{1,16}>.txt")`, "txt"))
+	s.Require().NoError(r.AddRoute(`Path("/files/<int:id>")`, "id"))
+	for _, route := range r.Routes() {
+		s.True(route.Merged, route.Expr)
+	}
+
+	// the shorter matches are tried when the rest of the pattern does not match the longest one
+	t4, l4 := makeTrie(s.T(), "/f/<re:name:.+>.txt", &pathMapper{}, "any")
+	for _, t := range []struct{ url, name string }{{"/f/a.txt", "a"}, {"/f/a.b.txt", "a.b"}, {"/f/a.txt.txt", "a.txt"}} {
+		st := &matchState{}
+		s.Equal(l4, t4.match(makeReq(req{url: t.url}), st), t.url)
+		s.Equal(Params{{Name: "name", Value: t.name}}, st.params, t.url)
+	}
+	s.Nil(t4.match(makeReq(req{url: "/f/.txt"}), nil))
+	s.Nil(t4.match(makeReq(req{url: "/f/a.txt/b"}), nil))
+
+	// the long segments are routed in linear time, the segments over the limit never match
+	t5, l5 := makeTrie(s.T(), "/files/<re:name:[a-z]+>.txt", &pathMapper{}, "long")
+	long := strings.Repeat("a", maxReSegment-4)
+	s.Equal(l5, t5.match(makeReq(req{url: "/files/" + long + ".txt"}), nil))
+	s.Nil(t5.match(makeReq(req{url: "/files/" + strings.Repeat("a", 16<<10) + ".txt"}), nil))
+	start := time.Now()
+	s.Nil(t4.match(makeReq(req{url: "/f/" + strings.Repeat(".", maxReSegment)}), nil))
+	s.Nil(t5.match(makeReq(req{url: "/files/" + strings.Repeat("a", 16<<10)}), nil))
+	s.Less(time.Since(start), time.Second)
+
+	_, err = newTrieMatcher("/<re:name:[a-z>", &pathMapper{}, &match{})
+	s.Error(err)
+	_, err = newTrieMatcher("/<re:name>", &pathMapper{}, &match{})
+	s.Error(err)
+}
+
+func (s *TrieSuite) TestPlaceholderConstraints() {
+	out, leaves := mergeTries(s.T(),
+		"/pages/<int:page:1-500>",
+		"/pages/<string:code:len=2>",
+		"/pages/<string:name:min=3:max=5>",
+		"/pages/<string:rest>",
+	)
+
+	tc := []struct {
+		url    string
+		expr   string
+		params Params
+	}{
+		{url: "/pages/1", expr: "/pages/<int:page:1-500>", params: Params{{Name: "page", Value: "1"}}},
+		{url: "/pages/500", expr: "/pages/<int:page:1-500>", params: Params{{Name: "page", Value: "500"}}},
+		{url: "/pages/501", expr: "/pages/<string:name:min=3:max=5>", params: Params{{Name: "name", Value: "501"}}},
+		{url: "/pages/0", expr: "/pages/<string:rest>", params: Params{{Name: "rest", Value: "0"}}},
+		{url: "/pages/99999999999999999999999", expr: "/pages/<string:rest>", params: Params{{Name: "rest", Value: "99999999999999999999999"}}},
+		{url: "/pages/en", expr: "/pages/<string:code:len=2>", params: Params{{Name: "code", Value: "en"}}},
+		{url: "/pages/hello", expr: "/pages/<string:name:min=3:max=5>", params: Params{{Name: "name", Value: "hello"}}},
+		{url: "/pages/hello!", expr: "/pages/<string:rest>", params: Params{{Name: "rest", Value: "hello!"}}},
+	}
+	for _, t := range tc {
+		st := &matchState{}
+		s.Equal(leaves[t.expr], out.match(makeReq(req{url: t.url}), st), t.url)
+		s.Equal(t.params, st.params, t.url)
+	}
+
+	// the matchers with the same constraints share the trie node
+	t1 := newTrie(s.T(), "/<int:page:1-500>/a", &pathMapper{}, "a")
+	t2 := newTrie(s.T(), "/<int:page:1-500>/b", &pathMapper{}, "b")
+	t3 := newTrie(s.T(), "/<int:page:1-50>/c", &pathMapper{}, "c")
+	t4 := newTrie(s.T(), "/<string:code:min=2:max=2>/d", &pathMapper{}, "d")
+	t5 := newTrie(s.T(), "/<string:code:len=2>/e", &pathMapper{}, "e")
+	var m matcher = t1
+	for _, t := range []*trie{t2, t3, t4, t5} {
+		var err error
+		m, err = m.merge(t)
+		s.Require().NoError(err)
+	}
+	var nodes []string
+	for _, c := range m.(*trie).root.children[0].children {
+		nodes = append(nodes, c.patternMatcher.String())
+	}
+	s.ElementsMatch([]string{"<int:page:1-500>", "<int:page:1-50>", "<string:code:len=2>"}, nodes)
+
+	for _, p := range []string{
+		"/<string:hi:omg:hello>",
+		"/<string:code:len=x>",
+		"/<string:code:min=5:max=2>",
+		"/<string:code:size=2>",
+		"/<int:page:500-1>",
+		"/<int:page:1>",
+		"/<int:page:1-5:2>",
+	} {
+		_, err := newTrieMatcher(p, &pathMapper{}, &match{})
+		s.Error(err, p)
+	}
+}
+
+func (s *TrieSuite) TestCustomPatternMatcher() {
+	t1, l1 := makeTrie(s.T(), "/items/<sku:id>", &pathMapper{}, "item")
+	t2, l2 := makeTrie(s.T(), "/items/<sku:id>/reviews", &pathMapper{}, "reviews")
+	t3, l3 := makeTrie(s.T(), "/items/<string:name>", &pathMapper{}, "name")
+	out, err := t1.merge(t2)
+	s.Require().NoError(err)
+	out, err = out.merge(t3)
+	s.Require().NoError(err)
+	s.Equal(`
+root(0)
+ node(0:/)
+  node(0:i)
+   node(0:t)
+    node(0:e)
+     node(0:m)
+      node(0:s)
+       node(0:/)
+        match(0:<sku:id>)
+         node(0:/)
+          node(0:r)
+           node(0:e)
+            node(0:v)
+             node(0:i)
+              node(0:e)
+               node(0:w)
+                match(0:s)
+        match(0:<string:name>)
+`, printTrie(out.(*trie)))
+
+	st := &matchState{}
+	s.Equal(l1, out.match(makeReq(req{url: "/items/AB-12"}), st))
+	s.Equal(Params{{Name: "id", Value: "AB-12"}}, st.params)
+	s.Equal(l2, out.match(makeReq(req{url: "/items/AB-12/reviews"}), nil))
+
+	// the characters consumed by the failed matcher are pushed back
+	st = &matchState{}
+	s.Equal(l3, out.match(makeReq(req{url: "/items/AB-12x"}), st))
+	s.Equal(Params{{Name: "name", Value: "AB-12x"}}, st.params)
+	s.Equal(l3, out.match(makeReq(req{url: "/items/ab-12"}), nil))
+
+	// the matcher stops at the chain boundary
+	method, err := newTrieMatcher("<sku:m>", &methodMapper{}, &match{})
+	s.Require().NoError(err)
+	chained, err := method.chain(t1)
+	s.Require().NoError(err)
+	st = &matchState{}
+	s.NotNil(chained.match(makeReq(req{url: "/items/CD-3", method: "AB-12"}), st))
+	s.Equal(Params{{Name: "m", Value: "AB-12"}, {Name: "id", Value: "CD-3"}}, st.params)
+
+	_, err = newTrieMatcher("/<sku:a:b>", &pathMapper{}, &match{})
+	s.EqualError(err, "sku matcher expects one argument, got [a b]")
+
+	s.Panics(func() { RegisterPatternMatcher("sku", newSkuMatcher) })
+	s.Panics(func() { RegisterPatternMatcher("int", newSkuMatcher) })
+	s.Panics(func() { RegisterPatternMatcher("a:b", newSkuMatcher) })
+}
+
 func BenchmarkMatching(b *testing.B) {
 	rndString := NewRndString()
 
@@ -338,7 +721,7 @@ func BenchmarkMatching(b *testing.B) {
 
 	req := makeReq(req{url: fmt.Sprintf("http://google.com/%s", rndString.MakePath(20, 10))})
 	for i := 0; i < b.N; i++ {
-		m.match(req)
+		m.match(req, nil)
 	}
 }
 
@@ -354,6 +737,28 @@ func makeTrie(t testing.TB, expr string, mp requestMapper, val interface{}) (*tr
 	return m, l
 }
 
+// mergeTries merges the path tries of the patterns, the routes are tried in the order of the patterns,
+// see match.less, the leaves are returned by pattern
+func mergeTries(t testing.TB, patterns ...string) (matcher, map[string]*match) {
+	t.Helper()
+
+	var out matcher
+	leaves := make(map[string]*match)
+	for i, expr := range patterns {
+		m, l := makeTrie(t, expr, &pathMapper{}, expr)
+		l.expr = fmt.Sprint(len(patterns) - i)
+		leaves[expr] = l
+		if out == nil {
+			out = m
+			continue
+		}
+		merged, err := out.merge(m)
+		require.NoError(t, err)
+		out = merged
+	}
+	return out, leaves
+}
+
 func newTrie(t testing.TB, expr string, mp requestMapper, val interface{}) *trie {
 	t.Helper()
 
@@ -407,3 +812,57 @@ func (r *RndString) MakeString(n int) string {
 func (r *RndString) MakePath(varLen, minLen int) string {
 	return fmt.Sprintf("/%s", r.MakeString(rand.Intn(varLen)+minLen))
 }
+
+func init() {
+	RegisterPatternMatcher("sku", newSkuMatcher)
+}
+
+// skuMatcher matches the SKUs like AB-12, two or more capital letters, dash and digits
+type skuMatcher struct {
+	name string
+}
+
+func newSkuMatcher(args []string) (PatternMatcher, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("sku matcher expects one argument, got %s", args)
+	}
+	return &skuMatcher{name: args[0]}, nil
+}
+
+func (m *skuMatcher) Name() string {
+	return m.name
+}
+
+func (m *skuMatcher) String() string {
+	return fmt.Sprintf("<sku:%s>", m.name)
+}
+
+func (m *skuMatcher) Equals(o PatternMatcher) bool {
+	other, ok := o.(*skuMatcher)
+	return ok && other.name == m.name
+}
+
+func (m *skuMatcher) Match(i Iterator) bool {
+	letters, digits := 0, 0
+	for {
+		c, sep, ok := i.Next()
+		if !ok {
+			break
+		}
+		if c == sep {
+			i.PushBack()
+			break
+		}
+		switch {
+		case c >= 'A' && c <= 'Z' && digits == 0 && letters >= 0:
+			letters++
+		case c == '-' && letters >= 2:
+			letters = -1
+		case c >= '0' && c <= '9' && letters == -1:
+			digits++
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
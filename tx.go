@@ -0,0 +1,132 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Tx stages the route updates applied by Router.Update
+type Tx = TypedTx[interface{}]
+
+// TypedTx stages the route updates applied by TypedRouter.Update. The updates are applied
+// in the order they are staged once the update function returns, and become visible all at once.
+type TypedTx[T any] interface {
+	// Add stages adding a route, the update fails if the expression already exists
+	Add(string, T)
+
+	// AddWithOptions works like Add, but lets to set route options, e.g. priority
+	AddWithOptions(string, T, RouteOptions)
+
+	// Upsert stages updating an existing route or adding a new route by given expression,
+	// the updated route keeps the options it was added with
+	Upsert(string, T)
+
+	// Remove stages removing a route by given expression
+	Remove(string)
+}
+
+type txOp struct {
+	expr string
+	// route is nil for the removed routes
+	route *parsedRoute
+	// add fails if the expression already exists
+	add bool
+	// strict rejects the route with Lint issues, see RouteOptions
+	strict bool
+}
+
+// tx collects the updates, the expressions are parsed while staging,
+// so the router is locked only to apply the parsed routes
+type tx[T any] struct {
+	ops  []txOp
+	errs []error
+}
+
+func (t *tx[T]) Add(expr string, val T) {
+	t.AddWithOptions(expr, val, RouteOptions{})
+}
+
+func (t *tx[T]) AddWithOptions(expr string, val T, opts RouteOptions) {
+	t.stage(expr, val, opts, true)
+}
+
+func (t *tx[T]) Upsert(expr string, val T) {
+	t.stage(expr, val, RouteOptions{}, false)
+}
+
+func (t *tx[T]) Remove(expr string) {
+	t.ops = append(t.ops, txOp{expr: expr})
+}
+
+func (t *tx[T]) stage(expr string, val T, opts RouteOptions, add bool) {
+	route, err := parseRoute(expr, val, opts)
+	if err != nil {
+		t.errs = append(t.errs, fmt.Errorf("expression '%s': %w", expr, err))
+		return
+	}
+	t.ops = append(t.ops, txOp{expr: expr, route: route, add: add, strict: opts.Strict})
+}
+
+func (r *typedRouter[T]) Update(fn func(TypedTx[T]) error) error {
+	t := &tx[T]{}
+	if err := fn(t); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s := r.compiled.Load()
+	// changes are the routes updated by the transaction, nil for the removed routes
+	changes := make(map[string]*parsedRoute)
+	lookup := func(expr string) *parsedRoute {
+		if route, ok := changes[expr]; ok {
+			return route
+		}
+		return s.routes.lookup(expr)
+	}
+
+	errs := t.errs
+	groups := s.groups
+	for k := range t.ops {
+		op := &t.ops[k]
+		prev := lookup(op.expr)
+		if op.add && prev != nil {
+			errs = append(errs, fmt.Errorf("expression '%s' already exists", op.expr))
+			continue
+		}
+		var err error
+		if prev != nil {
+			if groups, err = prev.removeFrom(groups); err != nil {
+				return err
+			}
+			if op.route != nil && !op.add {
+				if op.route, err = op.route.withOptions(op.expr, prev.opts); err != nil {
+					return err
+				}
+				op.strict = prev.opts.Strict
+			}
+		}
+		if op.route != nil {
+			if groups, err = op.route.addTo(groups); err != nil {
+				return fmt.Errorf("expression '%s': %w", op.expr, err)
+			}
+		}
+		changes[op.expr] = op.route
+	}
+	// the strict routes are checked against the routes of the whole transaction
+	for _, op := range t.ops {
+		if !op.strict || op.route == nil || changes[op.expr] != op.route {
+			continue
+		}
+		if err := checkStrict(groups, lookup, op.expr); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	r.publish(s.routes.with(changes), groups)
+	return nil
+}